@@ -3,8 +3,10 @@ package main
 import (
 	"flag"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/brucetruth/minigpt/llm/backend"
 	"github.com/brucetruth/minigpt/llm/tensor"
 )
 
@@ -12,27 +14,38 @@ func benchCmd(args []string) {
 	fs := flag.NewFlagSet("bench", flag.ExitOnError)
 	size := fs.Int("size", 256, "Matrix size N for NxN matmul")
 	iter := fs.Int("iter", 10, "Iterations")
+	workers := fs.Int("workers", 0, "MatMul worker goroutines (0 = GOMAXPROCS)")
+	naive := fs.Bool("naive", true, "Also time the naive reference kernel for comparison")
+	backendName := fs.String("backend", backend.Current.Name(), "Compute backend ("+strings.Join(backend.Names(), "|")+")")
 	fs.Parse(args)
-	
-	fmt.Printf("Benchmarking MatMul %dx%d for %d iters...\n", *size, *size, *iter)
-	
+	useBackend(*backendName)
+
+	tensor.MatMulWorkers = *workers
+
+	fmt.Printf("Benchmarking MatMul %dx%d for %d iters on %s backend...\n", *size, *size, *iter, backend.Current.Name())
+
 	a := tensor.NewRandom(*size, *size)
 	b := tensor.NewRandom(*size, *size)
-	
+
+	gflops := benchMatMul("MatMul", backend.MatMul, a, b, *iter)
+	if *naive {
+		ref := benchMatMul("Naive", tensor.NaiveMatMul, a, b, *iter)
+		fmt.Printf("Speedup over naive: %.2fx\n", gflops/ref)
+	}
+}
+
+// benchMatMul times matmul and returns the achieved GFLOPS.
+func benchMatMul(name string, matmul func(a, b *tensor.NDArray) *tensor.NDArray, a, b *tensor.NDArray, iter int) float64 {
 	start := time.Now()
-	for i := 0; i < *iter; i++ {
-		_ = tensor.MatMul(a, b)
+	for i := 0; i < iter; i++ {
+		_ = matmul(a, b)
 	}
 	dur := time.Since(start)
-	
-	fmt.Printf("Total time: %v\n", dur)
-	fmt.Printf("Avg time: %v\n", dur / time.Duration(*iter))
-	
-	ops := 2.0 * float64(*size) * float64(*size) * float64(*size) // 2*N^3
-	gflops := (ops * float64(*iter)) / dur.Seconds() / 1e9
-	fmt.Printf("GFLOPS: %.4f\n", gflops)
-}
 
-func tokenizeCmd(args []string) {
-	// TODO
+	size := a.Shape[0]
+	ops := 2.0 * float64(size) * float64(size) * float64(size) // 2*N^3
+	gflops := (ops * float64(iter)) / dur.Seconds() / 1e9
+
+	fmt.Printf("[%s] Total time: %v | Avg time: %v | GFLOPS: %.4f\n", name, dur, dur/time.Duration(iter), gflops)
+	return gflops
 }
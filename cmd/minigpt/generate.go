@@ -2,13 +2,16 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"math/rand"
 	"os"
+	"strings"
 	"time"
 
+	"github.com/brucetruth/minigpt/llm/backend"
 	llmio "github.com/brucetruth/minigpt/llm/io"
 	"github.com/brucetruth/minigpt/llm/tensor"
 	"github.com/brucetruth/minigpt/llm/tokenizer"
@@ -24,6 +27,9 @@ func generateCmd(args []string) {
 	topK := fs.Int("top-k", 0, "Top-k sampling (0 = disabled)")
 	topP := fs.Float64("top-p", 1.0, "Top-p (nucleus) sampling (1.0 = disabled)")
 	seed := fs.Int64("seed", -1, "Random seed (-1 for random)")
+	stopEOS := fs.Bool("stop-eos", true, "Stop at <|endoftext|> if the tokenizer has it")
+	strict := fs.Bool("strict", true, "Fail unless every weight in the checkpoint matches the model")
+	backendName := fs.String("backend", backend.Current.Name(), "Compute backend ("+strings.Join(backend.Names(), "|")+")")
 
 	// ... config flags if we can't load config from ckpt ...
 	// For simplicity, we hardcode config or expect args matching training.
@@ -34,6 +40,7 @@ func generateCmd(args []string) {
 	blockSize := fs.Int("block", 64, "")
 
 	fs.Parse(args)
+	useBackend(*backendName)
 
 	// Set random seed
 	if *seed >= 0 {
@@ -81,7 +88,7 @@ func generateCmd(args []string) {
 	// Override/Fallback with flags if config is zero (failed load)
 	if cfg.NEmb == 0 {
 		cfg = transformer.Config{
-			VocabSize: tok.VocabSize,
+			VocabSize: tok.VocabSize(),
 			BlockSize: *blockSize,
 			NLayer:    *nLayer,
 			NHead:     *nHead,
@@ -89,8 +96,10 @@ func generateCmd(args []string) {
 			PDrop:     0.0,
 		}
 	} else {
-		// Ensure vocab size matches tokenizer (in case it changed or was different)
-		cfg.VocabSize = tok.VocabSize
+		// The tokenizer must be the one the model was trained with
+		if tok.VocabSize() != cfg.VocabSize {
+			log.Fatalf("Tokenizer has %d tokens but the checkpoint model expects %d", tok.VocabSize(), cfg.VocabSize)
+		}
 		cfg.PDrop = 0.0 // Disable dropout for generation
 	}
 
@@ -100,49 +109,54 @@ func generateCmd(args []string) {
 
 	// Load Weights
 	log.Println("Loading weights...")
-	if _, err := llmio.LoadCheckpoint(*ckpt, model); err != nil {
-		fmt.Printf("Error loading weights: %v. Using random weights.\n", err)
-	} else {
-		fmt.Println("Weights loaded successfully.")
+	_, report, err := llmio.LoadCheckpointWithOptions(*ckpt, model, llmio.LoadOptions{Strict: *strict})
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		fmt.Printf("No weights found in %s. Using random weights.\n", *ckpt)
+	case err != nil:
+		log.Fatalf("Failed to load weights: %v", err)
+	case !report.OK():
+		fmt.Printf("Weights partially loaded: %d loaded, %d missing, %d unexpected, %d mismatched.\n",
+			len(report.Loaded), len(report.Missing), len(report.Unexpected), len(report.Mismatched))
+	default:
+		fmt.Printf("Weights loaded successfully (%d tensors).\n", len(report.Loaded))
 	}
 
-	// Encode prompt
-	ids := tok.Encode(*prompt)
+	// Encode prompt. Special tokens written in the prompt (e.g. chat
+	// markers) are encoded as such.
+	ids, err := tok.EncodeWithPolicy(*prompt, tokenizer.SpecialPolicy{AllowAll: true})
+	if err != nil {
+		log.Fatalf("Failed to encode prompt: %v", err)
+	}
+	if len(ids) == 0 {
+		log.Fatalf("Prompt encodes to no tokens")
+	}
 
-	// Generate loop
+	// Generate loop. The KV cache means each step only runs the newest token;
+	// the first step prefills the whole prompt.
+	eos, hasEOS := tok.SpecialID(tokenizer.EndOfText)
+	cache := transformer.NewKVCache(cfg)
+	pending := ids
+	// Tokens can end inside a UTF-8 character; print whole characters only
+	out := tokenizer.NewStreamDecoder(tok)
 	for i := 0; i < *tokens; i++ {
-		// Crop context
-		ctx := ids
-		if len(ctx) > cfg.BlockSize {
-			ctx = ctx[len(ctx)-cfg.BlockSize:]
-		}
-
-		// Prepare input tensor
-		b := 1
-		t := len(ctx)
-		x := tensor.New(b, t)
-		for j, id := range ctx {
-			x.Data[j] = float32(id)
-		}
-
-		// Forward
-		logits := model.Forward(x)
-
-		// Get last token logits: [1, T, V] -> [1, V]
-		vocabSize := logits.Shape[2]
-		lastLogits := tensor.New(vocabSize)
-		offset := (t - 1) * vocabSize
-		for j := 0; j < vocabSize; j++ {
-			lastLogits.Data[j] = logits.Data[offset+j]
-		}
+		// Forward: next-token logits [V]
+		lastLogits := model.NextLogits(pending, cache)
 
 		// Sample next token using temperature, top-k, top-p
 		nextID := tensor.SampleFromLogits(lastLogits, float32(*temperature), *topK, float32(*topP))
+		if *stopEOS && hasEOS && nextID == eos {
+			break
+		}
 
-		// To decode:
-		fmt.Print(tok.Decoder[nextID])
+		fmt.Print(out.Write(nextID))
 
 		ids = append(ids, nextID)
+		pending = []int{nextID}
+	}
+	rest, err := out.Flush()
+	fmt.Println(rest)
+	if err != nil {
+		log.Printf("Warning: %v", err)
 	}
-	fmt.Println()
 }
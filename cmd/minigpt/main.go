@@ -2,7 +2,10 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"os"
+
+	"github.com/brucetruth/minigpt/llm/backend"
 )
 
 func main() {
@@ -20,11 +23,22 @@ func main() {
 		benchCmd(os.Args[2:])
 	case "tokenize":
 		tokenizeCmd(os.Args[2:])
+	case "prepare":
+		prepareCmd(os.Args[2:])
+	case "sft":
+		sftCmd(os.Args[2:])
 	default:
 		help()
 	}
 }
 
+// useBackend selects the compute backend named by a --backend flag.
+func useBackend(name string) {
+	if err := backend.Use(name); err != nil {
+		log.Fatalf("%v", err)
+	}
+}
+
 func help() {
-	fmt.Println("Usage: minigpt [train|generate|bench|tokenize] [args]")
+	fmt.Println("Usage: minigpt [train|generate|bench|tokenize|prepare|sft] [args]")
 }
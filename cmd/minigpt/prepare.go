@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/brucetruth/minigpt/llm/data"
+	"github.com/brucetruth/minigpt/llm/tokenizer"
+)
+
+// prepareCmd tokenizes the input files once into a directory of token shards
+// (see data.ShardWriter) plus the tokenizer, for 'minigpt train --data'.
+func prepareCmd(args []string) {
+	fs := flag.NewFlagSet("prepare", flag.ExitOnError)
+	out := fs.String("out", "data/prepared", "Output directory")
+	tokPath := fs.String("tokenizer", "", "Use this tokenizer instead of training one on the input (also a GPT-2 directory, .tiktoken or Hugging Face tokenizer.json)")
+	tokType := fs.String("tokenizer-type", tokenizer.TypeBPE, "Type of a new tokenizer ("+strings.Join(tokenizer.Types(), "|")+")")
+	vocabSize := fs.Int("vocab-size", 1000, "Tokenizer vocabulary size when training a new tokenizer")
+	pattern := fs.String("pattern", "", "Pre-tokenization pattern for a new BPE tokenizer: gpt2, cl100k or a regexp")
+	special := fs.String("special", "", "Extra special tokens for a new tokenizer, comma-separated (<|endoftext|> is always added)")
+	trainBytes := fs.Int64("train-bytes", 64<<20, "Train a new tokenizer on at most this many bytes from the start of each file")
+	shardTokens := fs.Int64("shard-tokens", 1<<27, "Maximum tokens per shard")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		log.Fatalf("Usage: minigpt prepare [flags] files, globs or directories...")
+	}
+	paths, err := data.ExpandPaths(fs.Args())
+	if err != nil {
+		log.Fatalf("Failed to read input: %v", err)
+	}
+
+	var tok tokenizer.Tokenizer
+	if *tokPath != "" {
+		tok = loadTokenizer(*tokPath)
+	} else {
+		var docs []string
+		for _, path := range paths {
+			doc, err := readHead(path, *trainBytes)
+			if err != nil {
+				log.Fatalf("Failed to read input: %v", err)
+			}
+			docs = append(docs, doc)
+		}
+		tok = trainTokenizer(*tokType, *vocabSize, *pattern, *special, docs)
+	}
+
+	sw, err := data.NewShardWriter(*out, tok.VocabSize(), *shardTokens)
+	if err != nil {
+		log.Fatalf("Failed to create %s: %v", *out, err)
+	}
+	// Each file is a document, separated by <|endoftext|> like in train.
+	// Gzipped files are decompressed.
+	eot, hasEOT := tok.SpecialID(tokenizer.EndOfText)
+	for i, path := range paths {
+		if i > 0 && hasEOT {
+			if err := sw.Write([]int{eot}); err != nil {
+				log.Fatalf("Failed to write shard: %v", err)
+			}
+		}
+		f, err := data.OpenDocument(path)
+		if err != nil {
+			log.Fatalf("Failed to read input: %v", err)
+		}
+		err = tokenizer.EncodeStream(tok, f, sw.Write)
+		f.Close()
+		if err != nil {
+			log.Fatalf("Failed to encode %s: %v", path, err)
+		}
+		log.Printf("Encoded %s (%d tokens so far)\n", path, sw.Index().Tokens)
+	}
+	if err := sw.Close(); err != nil {
+		log.Fatalf("Failed to write shards: %v", err)
+	}
+	if err := tok.Save(filepath.Join(*out, "tokenizer.json")); err != nil {
+		log.Fatalf("Failed to save tokenizer: %v", err)
+	}
+
+	idx := sw.Index()
+	fmt.Printf("Wrote %d tokens in %d shards (uint%d) to %s\n", idx.Tokens, len(idx.Shards), 8*idx.TokenBytes, *out)
+}
+
+// readHead reads at most n bytes from the start of the (decompressed)
+// document at path.
+func readHead(path string, n int64) (string, error) {
+	f, err := data.OpenDocument(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	b, err := io.ReadAll(io.LimitReader(f, n))
+	return string(b), err
+}
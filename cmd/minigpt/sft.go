@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/brucetruth/minigpt/llm/backend"
+	"github.com/brucetruth/minigpt/llm/data"
+	llmio "github.com/brucetruth/minigpt/llm/io"
+	"github.com/brucetruth/minigpt/llm/nn"
+	"github.com/brucetruth/minigpt/llm/optim"
+	"github.com/brucetruth/minigpt/llm/tensor"
+	"github.com/brucetruth/minigpt/llm/tokenizer"
+	"github.com/brucetruth/minigpt/llm/transformer"
+)
+
+// sftCmd fine-tunes a checkpoint on a JSONL instruction dataset, training
+// only on the responses.
+func sftCmd(args []string) {
+	fs := flag.NewFlagSet("sft", flag.ExitOnError)
+	initDir := fs.String("init", "checkpoints", "Checkpoint directory to start from (weights, config and tokenizer)")
+	dataPath := fs.String("data", "data/sft.jsonl", "JSONL instruction data: comma-separated files, globs or directories")
+	valPath := fs.String("val-data", "", "Validation JSONL data (default: the last --val-split of --data)")
+	valSplit := fs.Float64("val-split", 0.1, "Fraction of the examples held out for validation when --val-data is not given")
+	steps := fs.Int("steps", 200, "Number of training steps")
+	batchSize := fs.Int("batch", 8, "Batch size (examples per step)")
+	lr := fs.Float64("lr", 1e-4, "Peak learning rate")
+	lrMin := fs.Float64("lr-min", 1e-5, "Minimum learning rate")
+	warmupSteps := fs.Int("warmup", 10, "Warmup steps")
+	labelSmoothing := fs.Float64("label-smoothing", 0, "Label smoothing of the training loss (0 = off); validation loss is always plain cross entropy")
+	maxGradNorm := fs.Float64("max-grad-norm", 1.0, "Max gradient norm (0 = no clipping)")
+	evalInterval := fs.Int("eval-interval", 50, "Evaluate validation loss every N steps (0 = never)")
+	evalIters := fs.Int("eval-iters", 10, "Maximum number of fixed validation batches per evaluation")
+	ckptInterval := fs.Int("ckpt-interval", 100, "Save checkpoint every N steps")
+	seed := fs.Int64("seed", 42, "Random seed")
+	outDir := fs.String("out", "checkpoints-sft", "Output directory")
+	backendName := fs.String("backend", backend.Current.Name(), "Compute backend ("+strings.Join(backend.Names(), "|")+")")
+
+	fs.Parse(args)
+	useBackend(*backendName)
+	if *labelSmoothing < 0 || *labelSmoothing >= 1 {
+		log.Fatalf("--label-smoothing must be in [0, 1), got %g", *labelSmoothing)
+	}
+	rand.Seed(*seed)
+
+	// Model and tokenizer from the checkpoint
+	meta, err := llmio.ReadMetadata(*initDir)
+	if err != nil {
+		log.Fatalf("Failed to read checkpoint metadata: %v", err)
+	}
+	cfg := meta.Config
+	tok, err := tokenizer.Load(*initDir + "/tokenizer.json")
+	if err != nil {
+		log.Fatalf("Failed to load tokenizer: %v", err)
+	}
+	if tok.VocabSize() != cfg.VocabSize {
+		log.Fatalf("Tokenizer in %s has %d tokens but the model expects %d", *initDir, tok.VocabSize(), cfg.VocabSize)
+	}
+	model := transformer.NewGPT(cfg)
+	if _, err := llmio.LoadCheckpoint(*initDir, model); err != nil {
+		log.Fatalf("Failed to load checkpoint: %v", err)
+	}
+	log.Printf("Loaded %s (step %d)\n", *initDir, meta.Step)
+
+	rngSrc := tensor.NewRNGSource(*seed)
+	model.SetRand(rand.New(rngSrc))
+
+	// Examples. Rows are padded with <|endoftext|> (masked out anyway).
+	encode := func(list string) []data.SFTExample {
+		paths, err := data.ExpandPaths(strings.Split(list, ","))
+		if err != nil {
+			log.Fatalf("Failed to read file: %v", err)
+		}
+		var examples []data.SFTExample
+		for _, path := range paths {
+			records, err := data.ReadSFT(path)
+			if err != nil {
+				log.Fatalf("Failed to read examples: %v", err)
+			}
+			for _, rec := range records {
+				examples = append(examples, data.EncodeSFT(tok, rec, data.DefaultChatTemplate))
+			}
+		}
+		return examples
+	}
+	examples := encode(*dataPath)
+	var valExamples []data.SFTExample
+	switch {
+	case *valPath != "":
+		valExamples = encode(*valPath)
+	case *valSplit > 0:
+		cut := len(examples) - int(float64(len(examples))**valSplit)
+		examples, valExamples = examples[:cut], examples[cut:]
+	}
+	pad, _ := tok.SpecialID(tokenizer.EndOfText)
+
+	ds := data.NewSFTDataset(examples, cfg.BlockSize, pad, *seed)
+	if ds.Len() == 0 {
+		log.Fatalf("No examples with response tokens within the block size (%d)", cfg.BlockSize)
+	}
+	log.Printf("Training on %d examples (%d skipped: no response within %d tokens)\n", ds.Len(), ds.Skipped, cfg.BlockSize)
+
+	// Fixed validation batches covering each validation example at most
+	// once; the last batch may be smaller
+	type batch struct {
+		x    *tensor.NDArray
+		y    []int
+		mask []float32
+	}
+	var valBatches []batch
+	if len(valExamples) > 0 && *evalInterval > 0 {
+		valDS := data.NewSFTDataset(valExamples, cfg.BlockSize, pad, *seed)
+		for i := 0; i < valDS.Len() && len(valBatches) < *evalIters; i += *batchSize {
+			x, y, mask := valDS.MaskedBatch(valDS.Examples[i:min(i+*batchSize, valDS.Len())])
+			valBatches = append(valBatches, batch{x, y, mask})
+		}
+		log.Printf("Validating on %d examples\n", valDS.Len())
+	}
+
+	opt := optim.NewAdamW(model.Parameters(), float32(*lr))
+	criterion := &nn.CrossEntropyLoss{LabelSmoothing: float32(*labelSmoothing)}
+	evalCriterion := nn.NewCrossEntropyLoss()
+	scheduler := optim.NewCosineScheduleWithWarmup(*warmupSteps, *steps, float32(*lr), float32(*lrMin))
+
+	evaluate := func() float32 {
+		model.SetTraining(false)
+		defer model.SetTraining(true)
+		var sum float32
+		for _, vb := range valBatches {
+			logits := model.Forward(vb.x)
+			b, t, v := logits.Shape[0], logits.Shape[1], logits.Shape[2]
+			logitsFlat, _ := logits.View(b*t, v)
+			sum += evalCriterion.ForwardMasked(logitsFlat, vb.y, vb.mask)
+		}
+		return sum / float32(len(valBatches))
+	}
+	var valLoss, bestValLoss float32
+
+	save := func(step int, loss float32) {
+		meta := llmio.CheckpointMetadata{
+			Step:        step,
+			Loss:        loss,
+			Config:      cfg,
+			ValLoss:     valLoss,
+			BestValLoss: bestValLoss,
+		}
+		if err := llmio.SaveCheckpoint(*outDir, model, meta); err != nil {
+			log.Printf("Failed to save checkpoint: %v", err)
+			return
+		}
+		if err := tok.Save(*outDir + "/tokenizer.json"); err != nil {
+			log.Printf("Failed to save tokenizer: %v", err)
+		}
+	}
+
+	// Loop
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	start := time.Now()
+	var loss, trainLossSum float32
+	trainLossN := 0
+	for step := 0; step < *steps; step++ {
+		if ctx.Err() != nil {
+			fmt.Printf("Interrupted, saving checkpoint at step %d...\n", step)
+			save(step, loss)
+			return
+		}
+		currentLR := scheduler.GetLR(step)
+		opt.SetLR(currentLR)
+
+		x, y, mask := ds.GetMaskedBatch(*batchSize)
+		logits := model.Forward(x)
+		b, t, v := logits.Shape[0], logits.Shape[1], logits.Shape[2]
+		logitsFlat, _ := logits.View(b*t, v)
+		loss = criterion.ForwardMasked(logitsFlat, y, mask)
+		trainLossSum += loss
+		trainLossN++
+
+		if step%10 == 0 {
+			fmt.Printf("Step %d | Loss: %.4f | LR: %.6f | Epoch: %d | Time: %v\n", step, loss, currentLR, ds.State().Epoch, time.Since(start))
+			start = time.Now()
+		}
+
+		opt.ZeroGrad()
+		dLogitsFlat := criterion.BackwardMasked(logitsFlat, y, mask)
+		dLogits, _ := dLogitsFlat.View(b, t, v)
+		model.Backward(dLogits)
+		if *maxGradNorm > 0 {
+			opt.ClipGradNorm(float32(*maxGradNorm))
+		}
+		opt.Step()
+
+		if len(valBatches) > 0 && ((step+1)%*evalInterval == 0 || step+1 == *steps) {
+			valLoss = evaluate()
+			if bestValLoss == 0 || valLoss < bestValLoss {
+				bestValLoss = valLoss
+			}
+			fmt.Printf("Eval %d | Train loss: %.4f | Val loss: %.4f | Val ppl: %.2f | Best val loss: %.4f\n",
+				step+1, trainLossSum/float32(trainLossN), valLoss, math.Exp(float64(valLoss)), bestValLoss)
+			trainLossSum, trainLossN = 0, 0
+		}
+
+		if *ckptInterval > 0 && (step+1)%*ckptInterval == 0 {
+			fmt.Printf("Saving checkpoint at step %d...\n", step+1)
+			save(step+1, loss)
+		}
+	}
+
+	fmt.Println("Saving final checkpoint...")
+	save(*steps, loss)
+	fmt.Println("Fine-tuning complete.")
+}
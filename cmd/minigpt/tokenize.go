@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/brucetruth/minigpt/llm/tokenizer"
+)
+
+func tokenizeCmd(args []string) {
+	if len(args) < 1 {
+		tokenizeHelp()
+		return
+	}
+
+	switch args[0] {
+	case "train":
+		tokenizeTrain(args[1:])
+	case "encode":
+		tokenizeEncode(args[1:])
+	case "decode":
+		tokenizeDecode(args[1:])
+	case "stats":
+		tokenizeStats(args[1:])
+	default:
+		tokenizeHelp()
+	}
+}
+
+func tokenizeHelp() {
+	fmt.Println("Usage: minigpt tokenize [train|encode|decode|stats] [args] [files...]")
+	fmt.Println("Files default to stdin. Binary ids are little-endian uint16, or uint32 if the vocab exceeds 65536.")
+}
+
+// tokenizeTrain trains a tokenizer on the input files and saves it.
+func tokenizeTrain(args []string) {
+	fs := flag.NewFlagSet("tokenize train", flag.ExitOnError)
+	typ := fs.String("type", tokenizer.TypeBPE, "Tokenizer type ("+strings.Join(tokenizer.Types(), "|")+")")
+	vocabSize := fs.Int("vocab-size", 1000, "Target vocabulary size (>= 256 for bpe and unigram)")
+	out := fs.String("out", "tokenizer.json", "Output tokenizer path")
+	pattern := fs.String("pattern", "", "BPE pre-tokenization pattern: gpt2, cl100k or a regexp (empty = raw bytes)")
+	special := fs.String("special", tokenizer.EndOfText, "Special tokens, comma-separated")
+	fs.Parse(args)
+
+	tok := newTokenizer(*typ, *vocabSize, *pattern)
+
+	text, err := readInputs(fs.Args())
+	if err != nil {
+		log.Fatalf("Failed to read input: %v", err)
+	}
+
+	if *special != "" {
+		tok.AddSpecial(strings.Split(*special, ",")...)
+	}
+	log.Printf("Training %s tokenizer on %d bytes...\n", tok.Type(), len(text))
+	tok.Train(text, *vocabSize)
+
+	if err := tok.Save(*out); err != nil {
+		log.Fatalf("Failed to save tokenizer: %v", err)
+	}
+	fmt.Printf("Saved %s tokenizer with %d tokens to %s\n", tok.Type(), tok.VocabSize(), *out)
+}
+
+// tokenizeEncode writes the ids of --text, or of the input files, as text
+// (one line of space-separated ids) or binary.
+func tokenizeEncode(args []string) {
+	fs := flag.NewFlagSet("tokenize encode", flag.ExitOnError)
+	tokPath := fs.String("tokenizer", "checkpoints/tokenizer.json", "Tokenizer path")
+	text := fs.String("text", "", "Text to encode (instead of files)")
+	format := fs.String("format", "text", "Output format (text|binary)")
+	out := fs.String("out", "", "Output path (default stdout)")
+	allowSpecial := fs.Bool("allow-special", false, "Encode special tokens in the input as their ids instead of as text")
+	fs.Parse(args)
+
+	tok := loadTokenizer(*tokPath)
+
+	var ids []int
+	switch {
+	case *allowSpecial:
+		input := *text
+		var err error
+		if input == "" {
+			if input, err = readInputs(fs.Args()); err != nil {
+				log.Fatalf("Failed to read input: %v", err)
+			}
+		}
+		if ids, err = tok.EncodeWithPolicy(input, tokenizer.SpecialPolicy{AllowAll: true}); err != nil {
+			log.Fatalf("Failed to encode: %v", err)
+		}
+	case *text != "":
+		ids = tok.Encode(*text)
+	default:
+		r, closeIn, err := openInputs(fs.Args())
+		if err != nil {
+			log.Fatalf("Failed to read input: %v", err)
+		}
+		ids, err = tokenizer.EncodeReader(tok, r)
+		closeIn()
+		if err != nil {
+			log.Fatalf("Failed to read input: %v", err)
+		}
+	}
+
+	w, closeOut := openOutput(*out)
+	defer closeOut()
+
+	switch *format {
+	case "text":
+		for i, id := range ids {
+			if i > 0 {
+				w.WriteByte(' ')
+			}
+			w.WriteString(strconv.Itoa(id))
+		}
+		w.WriteByte('\n')
+	case "binary":
+		if err := writeIDs(w, ids, idWidth(tok)); err != nil {
+			log.Fatalf("Failed to write ids: %v", err)
+		}
+	default:
+		log.Fatalf("Unknown format %q (want text or binary)", *format)
+	}
+}
+
+// tokenizeDecode reads ids from --ids or the input files and prints the text.
+func tokenizeDecode(args []string) {
+	fs := flag.NewFlagSet("tokenize decode", flag.ExitOnError)
+	tokPath := fs.String("tokenizer", "checkpoints/tokenizer.json", "Tokenizer path")
+	idList := fs.String("ids", "", "Space or comma separated ids (instead of files)")
+	format := fs.String("format", "text", "Input format (text|binary)")
+	out := fs.String("out", "", "Output path (default stdout)")
+	fs.Parse(args)
+
+	tok := loadTokenizer(*tokPath)
+
+	var ids []int
+	var err error
+	switch {
+	case *idList != "":
+		ids, err = parseIDs(*idList)
+	case *format == "text":
+		var input string
+		if input, err = readInputs(fs.Args()); err == nil {
+			ids, err = parseIDs(input)
+		}
+	case *format == "binary":
+		var input string
+		if input, err = readInputs(fs.Args()); err == nil {
+			ids, err = readIDs([]byte(input), idWidth(tok))
+		}
+	default:
+		log.Fatalf("Unknown format %q (want text or binary)", *format)
+	}
+	if err != nil {
+		log.Fatalf("Failed to read ids: %v", err)
+	}
+
+	for _, id := range ids {
+		if _, ok := tok.Token(id); !ok {
+			log.Fatalf("Id %d is not in the vocabulary (size %d)", id, tok.VocabSize())
+		}
+	}
+
+	w, closeOut := openOutput(*out)
+	defer closeOut()
+	w.WriteString(tok.Decode(ids))
+}
+
+// tokenizeStats prints the vocabulary size and, given input, the compression
+// ratio and the most frequent tokens.
+func tokenizeStats(args []string) {
+	fs := flag.NewFlagSet("tokenize stats", flag.ExitOnError)
+	tokPath := fs.String("tokenizer", "checkpoints/tokenizer.json", "Tokenizer path")
+	top := fs.Int("top", 20, "Number of most frequent tokens to list")
+	fs.Parse(args)
+
+	tok := loadTokenizer(*tokPath)
+	switch t := tok.(type) {
+	case *tokenizer.BPE:
+		fmt.Printf("Vocab size: %d (bpe: 256 byte tokens, %d merge rules, %d special)\n", t.VocabSize(), len(t.Merges), len(t.Special))
+	case *tokenizer.Unigram:
+		fmt.Printf("Vocab size: %d (unigram: 256 byte tokens, %d pieces, %d special)\n", t.VocabSize(), len(t.Pieces), len(t.Special))
+	case *tokenizer.Char:
+		fmt.Printf("Vocab size: %d (char: %d characters, 1 unknown, %d special)\n", t.VocabSize(), len(t.Chars)-1, len(t.Special))
+	case *tokenizer.Word:
+		fmt.Printf("Vocab size: %d (word: %d words and characters, 1 unknown, %d special)\n", t.VocabSize(), len(t.Words)-1, len(t.Special))
+	}
+
+	if len(fs.Args()) == 0 {
+		return
+	}
+	text, err := readInputs(fs.Args())
+	if err != nil {
+		log.Fatalf("Failed to read input: %v", err)
+	}
+	ids := tok.Encode(text)
+
+	fmt.Printf("Bytes: %d | Tokens: %d", len(text), len(ids))
+	if len(ids) > 0 {
+		fmt.Printf(" | Bytes/token: %.3f", float64(len(text))/float64(len(ids)))
+	}
+	fmt.Println()
+
+	counts := make(map[int]int)
+	for _, id := range ids {
+		counts[id]++
+	}
+	fmt.Printf("Distinct tokens used: %d of %d\n", len(counts), tok.VocabSize())
+
+	byCount := make([]int, 0, len(counts))
+	for id := range counts {
+		byCount = append(byCount, id)
+	}
+	sort.Slice(byCount, func(i, j int) bool {
+		if counts[byCount[i]] != counts[byCount[j]] {
+			return counts[byCount[i]] > counts[byCount[j]]
+		}
+		return byCount[i] < byCount[j]
+	})
+	if len(byCount) > *top {
+		byCount = byCount[:*top]
+	}
+
+	fmt.Println("Most frequent tokens:")
+	for _, id := range byCount {
+		share := 100 * float64(counts[id]) / float64(len(ids))
+		text, _ := tok.Token(id)
+		fmt.Printf("  %6d  %-24s %8d  %5.2f%%\n", id, strconv.Quote(text), counts[id], share)
+	}
+}
+
+func loadTokenizer(path string) tokenizer.Tokenizer {
+	tok, err := tokenizer.Import(path)
+	if err != nil {
+		log.Fatalf("Failed to load tokenizer: %v", err)
+	}
+	return tok
+}
+
+// trainTokenizer trains a new tokenizer of type typ on docs, with
+// <|endoftext|> and the comma-separated special tokens registered.
+func trainTokenizer(typ string, vocabSize int, pattern, special string, docs []string) tokenizer.Tokenizer {
+	tok := newTokenizer(typ, vocabSize, pattern)
+	tok.AddSpecial(tokenizer.EndOfText)
+	if special != "" {
+		tok.AddSpecial(strings.Split(special, ",")...)
+	}
+	log.Printf("Training %s tokenizer...\n", tok.Type())
+	tok.Train(strings.Join(docs, tokenizer.EndOfText), vocabSize)
+	return tok
+}
+
+// newTokenizer returns an untrained tokenizer of type typ for the train
+// commands, checking the flags that depend on the type.
+func newTokenizer(typ string, vocabSize int, pattern string) tokenizer.Tokenizer {
+	tok, err := tokenizer.NewOfType(typ)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	if (typ == tokenizer.TypeBPE || typ == tokenizer.TypeUnigram) && vocabSize < 256 {
+		log.Fatalf("--vocab-size must be at least 256 for %s tokenizers, got %d", typ, vocabSize)
+	}
+	if pattern != "" {
+		bpe, ok := tok.(*tokenizer.BPE)
+		if !ok {
+			log.Fatalf("--pattern only applies to bpe tokenizers")
+		}
+		if err := bpe.SetPattern(pattern); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	return tok
+}
+
+// readInputs concatenates the named files, or reads stdin if there are none
+// (or for a "-" entry).
+func readInputs(paths []string) (string, error) {
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+	var sb strings.Builder
+	for _, p := range paths {
+		var data []byte
+		var err error
+		if p == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(p)
+		}
+		if err != nil {
+			return "", err
+		}
+		sb.Write(data)
+	}
+	return sb.String(), nil
+}
+
+// openInputs returns the named files (stdin if there are none, or for a "-"
+// entry) as one stream, and a function that closes them.
+func openInputs(paths []string) (io.Reader, func(), error) {
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+	var readers []io.Reader
+	var files []*os.File
+	closeAll := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+	for _, p := range paths {
+		if p == "-" {
+			readers = append(readers, os.Stdin)
+			continue
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			closeAll()
+			return nil, nil, err
+		}
+		files = append(files, f)
+		readers = append(readers, f)
+	}
+	return io.MultiReader(readers...), closeAll, nil
+}
+
+// openOutput returns a buffered writer for path (stdout if empty) and a
+// function that flushes and closes it.
+func openOutput(path string) (*bufio.Writer, func()) {
+	f := os.Stdout
+	if path != "" {
+		var err error
+		if f, err = os.Create(path); err != nil {
+			log.Fatalf("Failed to create output: %v", err)
+		}
+	}
+	w := bufio.NewWriter(f)
+	return w, func() {
+		if err := w.Flush(); err != nil {
+			log.Fatalf("Failed to write output: %v", err)
+		}
+		if f != os.Stdout {
+			if err := f.Close(); err != nil {
+				log.Fatalf("Failed to write output: %v", err)
+			}
+		}
+	}
+}
+
+// idWidth is the number of bytes per id in binary files for tok.
+func idWidth(tok tokenizer.Tokenizer) int {
+	if tok.VocabSize() <= 1<<16 {
+		return 2
+	}
+	return 4
+}
+
+func writeIDs(w io.Writer, ids []int, width int) error {
+	buf := make([]byte, width*len(ids))
+	for i, id := range ids {
+		if width == 2 {
+			binary.LittleEndian.PutUint16(buf[2*i:], uint16(id))
+		} else {
+			binary.LittleEndian.PutUint32(buf[4*i:], uint32(id))
+		}
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+func readIDs(data []byte, width int) ([]int, error) {
+	if len(data)%width != 0 {
+		return nil, fmt.Errorf("binary input length %d is not a multiple of %d", len(data), width)
+	}
+	ids := make([]int, len(data)/width)
+	for i := range ids {
+		if width == 2 {
+			ids[i] = int(binary.LittleEndian.Uint16(data[2*i:]))
+		} else {
+			ids[i] = int(binary.LittleEndian.Uint32(data[4*i:]))
+		}
+	}
+	return ids, nil
+}
+
+// parseIDs parses whitespace or comma separated integers.
+func parseIDs(s string) ([]int, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\t' || r == '\r'
+	})
+	ids := make([]int, len(fields))
+	for i, f := range fields {
+		id, err := strconv.Atoi(f)
+		if err != nil {
+			return nil, fmt.Errorf("bad id %q", f)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
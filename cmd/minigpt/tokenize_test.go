@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brucetruth/minigpt/llm/tokenizer"
+)
+
+func TestTokenizeTrainSmallWordVocab(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "input.txt")
+	out := filepath.Join(dir, "tokenizer.json")
+	text := strings.Repeat("the cat sat on the mat. ", 20)
+	if err := os.WriteFile(input, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The 256-token minimum of byte-level tokenizers does not apply
+	tokenizeTrain([]string{"--type", "word", "--vocab-size", "100", "--out", out, input})
+
+	tok, err := tokenizer.Load(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Type() != tokenizer.TypeWord || tok.VocabSize() > 100 {
+		t.Fatalf("trained %s tokenizer with %d tokens", tok.Type(), tok.VocabSize())
+	}
+	if got := tok.Decode(tok.Encode(text)); got != text {
+		t.Errorf("round trip gave %q", got)
+	}
+}
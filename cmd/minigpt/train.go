@@ -1,24 +1,34 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"math"
 	"math/rand"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/brucetruth/minigpt/llm/backend"
 	"github.com/brucetruth/minigpt/llm/data"
 	llmio "github.com/brucetruth/minigpt/llm/io"
 	"github.com/brucetruth/minigpt/llm/nn"
 	"github.com/brucetruth/minigpt/llm/optim"
+	"github.com/brucetruth/minigpt/llm/tensor"
 	"github.com/brucetruth/minigpt/llm/tokenizer"
 	"github.com/brucetruth/minigpt/llm/transformer"
 )
 
 func trainCmd(args []string) {
 	fs := flag.NewFlagSet("train", flag.ExitOnError)
-	textPath := fs.String("text", "data/input.txt", "Path to input text")
+	textPath := fs.String("text", "data/input.txt", "Input text: comma-separated files, globs or directories; each file (optionally gzipped) is a document")
+	dataDir := fs.String("data", "", "Directory written by 'minigpt prepare' to train on instead of --text")
 	steps := fs.Int("steps", 100, "Number of training steps")
 	batchSize := fs.Int("batch", 8, "Batch size")
 	blockSize := fs.Int("block", 64, "Block size (context length)")
@@ -28,65 +38,370 @@ func trainCmd(args []string) {
 	lr := fs.Float64("lr", 1e-3, "Peak learning rate")
 	lrMin := fs.Float64("lr-min", 1e-4, "Minimum learning rate")
 	warmupSteps := fs.Int("warmup", 10, "Warmup steps")
+	labelSmoothing := fs.Float64("label-smoothing", 0, "Label smoothing of the training loss (0 = off); validation loss is always plain cross entropy")
 	maxGradNorm := fs.Float64("max-grad-norm", 1.0, "Max gradient norm (0 = no clipping)")
 	ckptInterval := fs.Int("ckpt-interval", 100, "Save checkpoint every N steps")
 	seed := fs.Int64("seed", 42, "Random seed")
 	outDir := fs.String("out", "checkpoints", "Output directory")
+	resume := fs.String("resume", "", "Checkpoint directory to resume training from")
+	vocabSize := fs.Int("vocab-size", 1000, "Tokenizer vocabulary size when training a new tokenizer")
+	tokPath := fs.String("tokenizer", "", "Use this tokenizer instead of training one on --text (also a GPT-2 directory, .tiktoken or Hugging Face tokenizer.json)")
+	special := fs.String("special", "", "Extra special tokens for a new tokenizer, comma-separated (<|endoftext|> is always added)")
+	pattern := fs.String("pattern", "", "Pre-tokenization pattern for a new BPE tokenizer: gpt2, cl100k or a regexp")
+	tokType := fs.String("tokenizer-type", tokenizer.TypeBPE, "Type of a new tokenizer ("+strings.Join(tokenizer.Types(), "|")+")")
+	valSplit := fs.Float64("val-split", 0, "Fraction of the training tokens held out for validation (unused with --val-text or --val-data)")
+	valText := fs.String("val-text", "", "Validation text, files, globs or directories like --text")
+	valDir := fs.String("val-data", "", "Validation directory written by 'minigpt prepare' with the same tokenizer as --data")
+	var sources sourceFlags
+	fs.Var(&sources, "source", "Named, weighted corpus NAME:WEIGHT:PATHS mixed with other --source flags instead of --text (repeatable; PATHS as for --text; empty WEIGHT = its size in tokens)")
+	prefetch := fs.Int("prefetch", 4, "Batches prepared ahead in the background")
+	loaderWorkers := fs.Int("loader-workers", 2, "Goroutines assembling prefetched batches")
+	mixTemp := fs.Float64("mix-temperature", 1, "Temperature of the --source mixture: source probabilities are proportional to WEIGHT^(1/T)")
+	docWindows := fs.Bool("doc-windows", false, "Keep training windows inside single documents of --text")
+	sampling := fs.String("sampling", "random", "Batch sampling: random (windows at random offsets) or epoch (every window once per epoch, shuffled)")
+	evalInterval := fs.Int("eval-interval", 100, "Evaluate validation loss every N steps (0 = never)")
+	evalIters := fs.Int("eval-iters", 20, "Number of fixed validation batches per evaluation")
+	backendName := fs.String("backend", backend.Current.Name(), "Compute backend ("+strings.Join(backend.Names(), "|")+")")
 
 	fs.Parse(args)
+	useBackend(*backendName)
+	if *labelSmoothing < 0 || *labelSmoothing >= 1 {
+		log.Fatalf("--label-smoothing must be in [0, 1), got %g", *labelSmoothing)
+	}
 
 	// Determinism
 	rand.Seed(*seed)
 
-	// Load Text
-	content, err := os.ReadFile(*textPath)
-	if err != nil {
-		log.Fatalf("Failed to read file: %v", err)
+	// Load Text. Each file is a document; documents are separated by
+	// <|endoftext|> so the model learns where one ends. Several --source
+	// corpora are mixed by weight. Prepared data is already tokenized.
+	if len(sources) > 0 && *dataDir != "" {
+		log.Fatalf("--source cannot be used with --data")
+	}
+	if len(sources) == 0 && *dataDir == "" {
+		sources = sourceFlags{{name: "text", paths: *textPath}}
+	}
+	var docs []string
+	sourceDocs := make([][]string, len(sources))
+	for i, sp := range sources {
+		sourceDocs[i] = readDocuments(sp.paths)
+		docs = append(docs, sourceDocs[i]...)
 	}
-	text := string(content)
-
-	// Tokenizer
-	log.Println("Training tokenizer...")
-	tok := tokenizer.New()
-	tok.Train(text, 1000) // Small vocab for testing/speed
-	// Encode
-	ids := tok.Encode(text)
-	log.Printf("Encoded %d chars to %d tokens\n", len(text), len(ids))
 
-	// Dataset
-	ds := data.NewTextDataset(ids, *blockSize)
+	// Tokenizer. A resumed run must reuse the checkpoint's tokenizer,
+	// otherwise the token ids (and the batches) would differ.
+	// Prepared data was tokenized with the tokenizer saved next to it.
+	var tok tokenizer.Tokenizer
+	var err error
+	if *tokPath != "" && (*resume != "" || *dataDir != "") {
+		log.Fatalf("--tokenizer cannot be used with --resume or --data; their tokenizer is always reused")
+	}
+	switch {
+	case *resume != "":
+		tok, err = tokenizer.Load(*resume + "/tokenizer.json")
+		if err != nil {
+			log.Fatalf("Failed to load tokenizer: %v", err)
+		}
+	case *dataDir != "":
+		tok, err = tokenizer.Load(filepath.Join(*dataDir, "tokenizer.json"))
+		if err != nil {
+			log.Fatalf("Failed to load tokenizer: %v", err)
+		}
+	case *tokPath != "":
+		tok, err = tokenizer.Import(*tokPath)
+		if err != nil {
+			log.Fatalf("Failed to load tokenizer: %v", err)
+		}
+		log.Printf("Loaded %s tokenizer from %s (%d tokens)\n", tok.Type(), *tokPath, tok.VocabSize())
+	default:
+		tok = trainTokenizer(*tokType, *vocabSize, *pattern, *special, docs)
+	}
+	// Encode each source
+	sourceIDs := make([][]int, len(sources))
+	for i, docs := range sourceDocs {
+		sourceIDs[i] = tokenizer.EncodeDocuments(tok, docs)
+		chars := 0
+		for _, doc := range docs {
+			chars += len(doc)
+		}
+		log.Printf("Encoded %d chars in %d documents to %d tokens (%s)\n", chars, len(docs), len(sourceIDs[i]), sources[i].name)
+	}
 
 	// Config
 	cfg := transformer.Config{
-		VocabSize: tok.VocabSize,
+		VocabSize: tok.VocabSize(),
 		BlockSize: *blockSize,
 		NLayer:    *nLayer,
 		NHead:     *nHead,
 		NEmb:      *embDim,
 		PDrop:     0.1,
 	}
+	if *resume != "" {
+		meta, err := llmio.ReadMetadata(*resume)
+		if err != nil {
+			log.Fatalf("Failed to read checkpoint metadata: %v", err)
+		}
+		cfg = meta.Config
+		if tok.VocabSize() != cfg.VocabSize {
+			log.Fatalf("Tokenizer in %s has %d tokens but the model expects %d", *resume, tok.VocabSize(), cfg.VocabSize)
+		}
+	}
+
+	// Seeded, checkpointable sources for dropout and for batch sampling,
+	// which runs on the loader's goroutine
+	rngSrc := tensor.NewRNGSource(*seed)
+	rng := rand.New(rngSrc)
+	dataRngSrc := tensor.NewRNGSource(*seed + 1)
+	dataRng := rand.New(dataRngSrc)
+
+	// Dataset
+	var srcs []data.TokenSource
+	if *dataDir != "" {
+		if *docWindows {
+			log.Fatalf("--doc-windows cannot be used with --data")
+		}
+		shards := openShards(*dataDir, cfg.BlockSize, tok)
+		defer shards.Close()
+		srcs = append(srcs, shards)
+	}
+	for _, ids := range sourceIDs {
+		text := data.NewTextDataset(ids, cfg.BlockSize)
+		if *docWindows {
+			eot, ok := tok.SpecialID(tokenizer.EndOfText)
+			if !ok {
+				log.Fatalf("--doc-windows needs a tokenizer with %s", tokenizer.EndOfText)
+			}
+			text.DocStarts = data.DocStarts(ids, eot)
+		}
+		srcs = append(srcs, text)
+	}
+
+	// Validation data: a separate corpus, or the tail of each training one
+	var vals []data.TokenSource
+	trains := srcs
+	switch {
+	case *valDir != "":
+		shards := openShards(*valDir, cfg.BlockSize, tok)
+		defer shards.Close()
+		vals = append(vals, shards)
+	case *valText != "":
+		vals = append(vals, data.NewTextDataset(tokenizer.EncodeDocuments(tok, readDocuments(*valText)), cfg.BlockSize))
+	case *valSplit > 0:
+		trains = make([]data.TokenSource, len(srcs))
+		for i, src := range srcs {
+			var val *data.Range
+			trains[i], val = data.Split(src, cfg.BlockSize, *valSplit)
+			vals = append(vals, val)
+		}
+	}
+	// Too little to fill a window: train on everything, without evaluation
+	for _, val := range vals {
+		if !data.HasWindow(val, cfg.BlockSize) {
+			log.Printf("Warning: validation data (%d tokens) has no window of %d tokens; skipping evaluation\n", val.Len(), cfg.BlockSize+1)
+			vals, trains = nil, srcs
+			break
+		}
+	}
+	srcs = trains
+	if len(vals) > 0 {
+		log.Printf("Training on %d tokens, validating on %d\n", totalLen(srcs), totalLen(vals))
+	}
+
+	// One sampler per source; sources shuffle their epochs independently
+	samplers := make([]data.Dataset, len(srcs))
+	for i, src := range srcs {
+		if !data.HasWindow(src, cfg.BlockSize) {
+			name := *dataDir
+			if i < len(sources) {
+				name = sources[i].name
+			}
+			log.Fatalf("Training data %s (%d tokens) has no window of %d tokens; use more data or a smaller --block", name, src.Len(), cfg.BlockSize+1)
+		}
+		switch *sampling {
+		case "epoch":
+			iter := data.NewIterator(src, cfg.BlockSize, *seed+int64(i)<<32)
+			log.Printf("%d windows per epoch\n", iter.Windows())
+			samplers[i] = iter
+		case "random":
+			samplers[i] = &data.Range{Source: src, End: src.Len(), BlockSize: cfg.BlockSize, Rand: dataRng}
+		default:
+			log.Fatalf("Unknown sampling %q (want epoch or random)", *sampling)
+		}
+	}
+	var ds data.Dataset
+	var iter *data.Iterator
+	var mix *data.Mixture
+	if len(samplers) == 1 {
+		ds = samplers[0]
+		iter, _ = ds.(*data.Iterator)
+	} else {
+		mix = newMixture(sources, srcs, samplers, *mixTemp)
+		mix.Rand = dataRng
+		for i, p := range mix.Probabilities() {
+			log.Printf("Source %s: %d tokens, sampled %.1f%% of the time\n", sources[i].name, srcs[i].Len(), 100*p)
+		}
+		ds = mix
+	}
+
+	// Fixed validation batches, drawn from their own stream so evaluation
+	// leaves the training batches and dropout masks unchanged
+	type batch struct {
+		x *tensor.NDArray
+		y []int
+	}
+	var valBatches []batch
+	if len(vals) > 0 && *evalInterval > 0 {
+		valRng := rand.New(rand.NewSource(*seed))
+		valSamplers := make([]data.Dataset, len(vals))
+		for i, val := range vals {
+			valSamplers[i] = &data.Range{Source: val, End: val.Len(), BlockSize: cfg.BlockSize, Rand: valRng}
+		}
+		valDS := valSamplers[0]
+		if len(vals) > 1 {
+			valMix := newMixture(sources, srcs, valSamplers, *mixTemp)
+			valMix.Rand = valRng
+			valDS = valMix
+		}
+		for i := 0; i < *evalIters; i++ {
+			x, y := valDS.GetBatch(*batchSize)
+			valBatches = append(valBatches, batch{x, y})
+		}
+	}
 
 	// Model
 	log.Println("Initializing model...")
 	model := transformer.NewGPT(cfg)
+	model.SetRand(rng)
 
 	// Optimizer
 	opt := optim.NewAdamW(model.Parameters(), float32(*lr))
-	criterion := nn.NewCrossEntropyLoss()
+	criterion := &nn.CrossEntropyLoss{LabelSmoothing: float32(*labelSmoothing)}
+	evalCriterion := nn.NewCrossEntropyLoss()
 
 	// LR Scheduler
 	scheduler := optim.NewCosineScheduleWithWarmup(*warmupSteps, *steps, float32(*lr), float32(*lrMin))
 
+	// evaluate returns the mean loss over the validation batches, with
+	// dropout off.
+	evaluate := func() float32 {
+		model.SetTraining(false)
+		defer model.SetTraining(true)
+		var sum float32
+		for _, vb := range valBatches {
+			logits := model.Forward(vb.x)
+			b, t, v := logits.Shape[0], logits.Shape[1], logits.Shape[2]
+			logitsFlat, _ := logits.View(b*t, v)
+			sum += evalCriterion.Forward(logitsFlat, vb.y)
+		}
+		return sum / float32(len(valBatches))
+	}
+	var valLoss, bestValLoss float32
+
+	// Resume: weights, optimizer moments, RNG and step counter
+	startStep := 0
+	if *resume != "" {
+		meta, err := llmio.LoadCheckpoint(*resume, model)
+		if err != nil {
+			log.Fatalf("Failed to load checkpoint: %v", err)
+		}
+		valLoss, bestValLoss = meta.ValLoss, meta.BestValLoss
+		state, err := llmio.LoadTrainingState(*resume, model)
+		if err != nil {
+			log.Fatalf("Failed to load training state: %v", err)
+		}
+		if err := opt.LoadState(state.Optimizer); err != nil {
+			log.Fatalf("Failed to restore optimizer: %v", err)
+		}
+		rngSrc.SetState(state.RNGState)
+		dataRngSrc.SetState(state.DataRNGState)
+		if iter != nil && state.Data != nil {
+			iter.SetState(*state.Data)
+		}
+		if mix != nil && state.Mixture != nil {
+			if err := mix.SetState(*state.Mixture); err != nil {
+				log.Fatalf("Failed to restore data mixture: %v", err)
+			}
+		}
+		startStep = state.Step
+		log.Printf("Resumed from %s at step %d\n", *resume, startStep)
+	}
+
+	// Batches are prepared in the background; each carries the data
+	// position after it, which is what a checkpoint must store
+	snapshot := func() any {
+		st := dataState{rng: dataRngSrc.State()}
+		if iter != nil {
+			pos := iter.State()
+			st.iter = &pos
+		}
+		if mix != nil {
+			pos := mix.State()
+			st.mix = &pos
+		}
+		return st
+	}
+	dataPos := snapshot().(dataState)
+	loader := data.NewLoader(ds, *batchSize, data.LoaderOptions{Prefetch: *prefetch, Workers: *loaderWorkers, Snapshot: snapshot})
+	defer loader.Close()
+
+	save := func(step int, loss float32) {
+		meta := llmio.CheckpointMetadata{
+			Step:        step,
+			Loss:        loss,
+			Config:      cfg,
+			ValLoss:     valLoss,
+			BestValLoss: bestValLoss,
+		}
+		if err := llmio.SaveCheckpoint(*outDir, model, meta); err != nil {
+			log.Printf("Failed to save checkpoint: %v", err)
+			return
+		}
+		state := &llmio.TrainingState{
+			Step:         step,
+			RNGState:     rngSrc.State(),
+			DataRNGState: dataPos.rng,
+			Optimizer:    opt.State(),
+			Data:         dataPos.iter,
+			Mixture:      dataPos.mix,
+		}
+		if err := llmio.SaveTrainingState(*outDir, model, state); err != nil {
+			log.Printf("Failed to save training state: %v", err)
+		}
+		if err := tok.Save(*outDir + "/tokenizer.json"); err != nil {
+			log.Printf("Failed to save tokenizer: %v", err)
+		}
+	}
+
 	// Loop
 	start := time.Now()
-	var loss float32
-	for step := 0; step < *steps; step++ {
+	var loss, trainLossSum float32
+	trainLossN := 0
+	epoch := 0
+	if dataPos.iter != nil {
+		epoch = dataPos.iter.Epoch
+	}
+	// Stop cleanly on Ctrl-C or SIGTERM, saving a checkpoint to resume from
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	for step := startStep; step < *steps; step++ {
+		if ctx.Err() != nil {
+			fmt.Printf("Interrupted, saving checkpoint at step %d...\n", step)
+			save(step, loss)
+			return
+		}
+
 		// Update learning rate
 		currentLR := scheduler.GetLR(step)
 		opt.SetLR(currentLR)
 
 		// 1. Batch
-		x, y := ds.GetBatch(*batchSize)
+		batch := loader.Next()
+		x, y := batch.X, batch.Y
+		dataPos = batch.State.(dataState)
+		if dataPos.iter != nil && dataPos.iter.Epoch > epoch {
+			epoch = dataPos.iter.Epoch
+			log.Printf("Started epoch %d at step %d\n", epoch, step)
+		}
 
 		// 2. Forward
 		logits := model.Forward(x)
@@ -95,6 +410,8 @@ func trainCmd(args []string) {
 		b, t, v := logits.Shape[0], logits.Shape[1], logits.Shape[2]
 		logitsFlat, _ := logits.View(b*t, v)
 		loss = criterion.Forward(logitsFlat, y)
+		trainLossSum += loss
+		trainLossN++
 
 		if step%10 == 0 {
 			fmt.Printf("Step %d | Loss: %.4f | LR: %.6f | Time: %v\n", step, loss, currentLR, time.Since(start))
@@ -116,34 +433,144 @@ func trainCmd(args []string) {
 		// 5. Step
 		opt.Step()
 
+		// Evaluate, comparing against the mean training loss since the
+		// last evaluation
+		if len(valBatches) > 0 && ((step+1)%*evalInterval == 0 || step+1 == *steps) {
+			valLoss = evaluate()
+			if bestValLoss == 0 || valLoss < bestValLoss {
+				bestValLoss = valLoss
+			}
+			trainLoss := trainLossSum / float32(trainLossN)
+			fmt.Printf("Eval %d | Train loss: %.4f | Val loss: %.4f | Val ppl: %.2f | Best val loss: %.4f\n",
+				step+1, trainLoss, valLoss, math.Exp(float64(valLoss)), bestValLoss)
+			trainLossSum, trainLossN = 0, 0
+			if mix != nil {
+				fmt.Printf("Tokens per source: %s\n", mixtureTokens(sources, dataPos.mix.Tokens))
+			}
+		}
+
 		// Save checkpoint periodically
 		if *ckptInterval > 0 && (step+1)%*ckptInterval == 0 {
 			fmt.Printf("Saving checkpoint at step %d...\n", step+1)
-			meta := llmio.CheckpointMetadata{
-				Step:   step + 1,
-				Loss:   loss,
-				Config: cfg,
-			}
-			if err := llmio.SaveCheckpoint(*outDir, model, meta); err != nil {
-				log.Printf("Failed to save checkpoint: %v", err)
-			}
-			tok.Save(*outDir + "/tokenizer.json")
+			save(step+1, loss)
 		}
 	}
 
-	// Save final checkpoint
+	if mix != nil && len(valBatches) == 0 { // Otherwise printed by the last evaluation
+		fmt.Printf("Tokens per source: %s\n", mixtureTokens(sources, dataPos.mix.Tokens))
+	}
+
+	// Save final checkpoint (with tokenizer and training state)
 	fmt.Println("Saving final checkpoint...")
-	meta := llmio.CheckpointMetadata{
-		Step:   *steps,
-		Loss:   loss,
-		Config: cfg,
+	save(*steps, loss)
+
+	fmt.Println("Training complete.")
+}
+
+// openShards maps a directory written by 'minigpt prepare', which must have
+// been tokenized with tok.
+func openShards(dir string, blockSize int, tok tokenizer.Tokenizer) *data.ShardDataset {
+	shards, err := data.OpenShards(dir, blockSize)
+	if err != nil {
+		log.Fatalf("Failed to open prepared data: %v", err)
+	}
+	if shards.Index.VocabSize != tok.VocabSize() {
+		log.Fatalf("Data in %s was prepared for %d tokens but the tokenizer has %d", dir, shards.Index.VocabSize, tok.VocabSize())
+	}
+	log.Printf("Mapped %d tokens in %d shards from %s\n", shards.Len(), len(shards.Index.Shards), dir)
+	return shards
+}
+
+// readDocuments reads the files named by a comma-separated list of files,
+// globs and directories, one document per file.
+func readDocuments(list string) []string {
+	paths, err := data.ExpandPaths(strings.Split(list, ","))
+	if err != nil {
+		log.Fatalf("Failed to read file: %v", err)
 	}
-	if err := llmio.SaveCheckpoint(*outDir, model, meta); err != nil {
-		log.Printf("Failed to save checkpoint: %v", err)
+	docs, err := data.ReadDocuments(paths)
+	if err != nil {
+		log.Fatalf("Failed to read file: %v", err)
 	}
+	return docs
+}
 
-	// Save tokenizer
-	tok.Save(*outDir + "/tokenizer.json")
+// sourceFlags collects repeated --source NAME:WEIGHT:PATHS flags.
+type sourceFlags []sourceSpec
 
-	fmt.Println("Training complete.")
+type sourceSpec struct {
+	name   string
+	weight float64 // 0 = size in tokens
+	paths  string
+}
+
+func (f *sourceFlags) String() string {
+	var specs []string
+	for _, sp := range *f {
+		specs = append(specs, fmt.Sprintf("%s:%g:%s", sp.name, sp.weight, sp.paths))
+	}
+	return strings.Join(specs, " ")
+}
+
+func (f *sourceFlags) Set(v string) error {
+	parts := strings.SplitN(v, ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return fmt.Errorf("want NAME:WEIGHT:PATHS, got %q", v)
+	}
+	sp := sourceSpec{name: parts[0], paths: parts[2]}
+	if parts[1] != "" {
+		w, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || !(w > 0) {
+			return fmt.Errorf("source %s: weight must be a positive number, got %q", sp.name, parts[1])
+		}
+		sp.weight = w
+	}
+	*f = append(*f, sp)
+	return nil
+}
+
+// newMixture mixes the samplers of the sources' training token sources,
+// weighting a source without a weight by its size.
+func newMixture(specs []sourceSpec, srcs []data.TokenSource, samplers []data.Dataset, temperature float64) *data.Mixture {
+	components := make([]data.MixtureSource, len(specs))
+	for i, sp := range specs {
+		w := sp.weight
+		if w == 0 {
+			w = float64(srcs[i].Len())
+		}
+		components[i] = data.MixtureSource{Name: sp.name, Data: samplers[i], Weight: w}
+	}
+	mix, err := data.NewMixture(components, temperature)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	return mix
+}
+
+// mixtureTokens lists the tokens drawn from each source.
+func mixtureTokens(specs []sourceSpec, tokens []int64) string {
+	var total int64
+	for _, n := range tokens {
+		total += n
+	}
+	parts := make([]string, len(tokens))
+	for i, n := range tokens {
+		parts[i] = fmt.Sprintf("%s %d (%.1f%%)", specs[i].name, n, 100*float64(n)/float64(max(total, 1)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func totalLen(srcs []data.TokenSource) int {
+	n := 0
+	for _, src := range srcs {
+		n += src.Len()
+	}
+	return n
+}
+
+// dataState is the position of the training data after a batch.
+type dataState struct {
+	rng  uint64
+	iter *data.IteratorState
+	mix  *data.MixtureState
 }
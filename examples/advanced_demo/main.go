@@ -49,7 +49,7 @@ Arthur set off on his adventure, carrying the magical crystal and the wisdom of
 
 	// Larger model configuration
 	cfg := transformer.Config{
-		VocabSize: tok.VocabSize,
+		VocabSize: tok.VocabSize(),
 		BlockSize: 32,
 		NLayer:    3,
 		NHead:     4,
@@ -138,34 +138,17 @@ Arthur set off on his adventure, carrying the magical crystal and the wisdom of
 
 			ids := tok.Encode(prompt)
 
-			// Generate 30 tokens
+			// Generate 30 tokens, reusing the KV cache between steps
+			cache := transformer.NewKVCache(cfg)
+			pending := ids
 			for j := 0; j < 30; j++ {
-				// Context window
-				ctx := ids
-				if len(ctx) > cfg.BlockSize {
-					ctx = ctx[len(ctx)-cfg.BlockSize:]
-				}
-
-				// Prepare input [1, T]
-				x := tensor.New(1, len(ctx))
-				for k, id := range ctx {
-					x.Data[k] = float32(id)
-				}
-
-				// Forward
-				logits := model.Forward(x)
-
-				// Get last token logits
-				vocabSize := logits.Shape[2]
-				lastLogits := tensor.New(vocabSize)
-				offset := (len(ctx) - 1) * vocabSize
-				for k := 0; k < vocabSize; k++ {
-					lastLogits.Data[k] = logits.Data[offset+k]
-				}
+				// Forward: logits for the next token
+				lastLogits := model.NextLogits(pending, cache)
 
 				// Sample with strategy
 				nextID := tensor.SampleFromLogits(lastLogits, strat.temp, strat.topK, strat.topP)
 				ids = append(ids, nextID)
+				pending = []int{nextID}
 			}
 
 			// Decode and print
@@ -183,4 +166,5 @@ Arthur set off on his adventure, carrying the magical crystal and the wisdom of
 	fmt.Println("  ✓ LR scheduling (warmup + cosine decay)")
 	fmt.Println("  ✓ Gradient clipping")
 	fmt.Println("  ✓ Temperature / top-k / top-p sampling")
+	fmt.Println("  ✓ KV-cached incremental decoding")
 }
@@ -45,7 +45,7 @@ func main() {
 
 	// Configure model
 	cfg := transformer.Config{
-		VocabSize: tok.VocabSize,
+		VocabSize: tok.VocabSize(),
 		BlockSize: blockSize,
 		NLayer:    1,
 		NHead:     2,
@@ -109,44 +109,19 @@ func main() {
 	generated := make([]int, len(promptIds))
 	copy(generated, promptIds)
 
-	for i := 0; i < 10; i++ {
-		// Prepare context
-		ctx := generated
-		if len(ctx) > blockSize {
-			ctx = ctx[len(ctx)-blockSize:]
-		}
-
-		// Create input tensor
-		x := make([]float32, len(ctx))
-		for j, id := range ctx {
-			x[j] = float32(id)
-		}
-
-		// Import tensor package for creating input
-		input := tensor.NewFromData(x, 1, len(ctx))
+	// The KV cache lets each step process only the newest token.
+	cache := transformer.NewKVCache(cfg)
+	pending := promptIds
 
-		// Forward
-		logits := model.Forward(input)
-
-		// Get last token logits
-		vocabSize := logits.Shape[2]
-		lastLogits := make([]float32, vocabSize)
-		offset := (len(ctx) - 1) * vocabSize
-		for j := 0; j < vocabSize; j++ {
-			lastLogits[j] = logits.Data[offset+j]
-		}
+	for i := 0; i < 10; i++ {
+		// Forward: logits for the next token
+		lastLogits := model.NextLogits(pending, cache)
 
 		// Greedy sample (argmax)
-		maxIdx := 0
-		maxVal := lastLogits[0]
-		for j := 1; j < vocabSize; j++ {
-			if lastLogits[j] > maxVal {
-				maxVal = lastLogits[j]
-				maxIdx = j
-			}
-		}
+		maxIdx := tensor.ArgMax(lastLogits)[0]
 
 		generated = append(generated, maxIdx)
+		pending = []int{maxIdx}
 	}
 
 	// Decode
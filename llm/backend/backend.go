@@ -1,38 +1,125 @@
 package backend
 
 import (
+	"fmt"
+	"sort"
+
 	"github.com/brucetruth/minigpt/llm/tensor"
 )
 
+// Backend implements the heavy tensor operations. Layers in llm/nn and
+// llm/transformer call them through the package-level functions below, which
+// dispatch to Current. Every backend must pass the conformance tests in
+// backend_test.go against the reference implementations in llm/tensor.
 type Backend interface {
-	MatMul(a, b *tensor.NDArray, out *tensor.NDArray)
-}
-
-var Current Backend = &PureGoBackend{}
-
-type PureGoBackend struct{}
-
-func (b *PureGoBackend) MatMul(a, rhs *tensor.NDArray, out *tensor.NDArray) {
-	// Call Pure Go implementation
-	// We need to move the actual loop here or keep it in tensor and call it?
-	// To avoid circular imports, tensor depends on backend or backend depends on tensor?
-	// tensor package defines NDArray. backend uses NDArray.
-	// tensor package should call backend.
-	// So tensor imports backend.
-	// backend imports tensor. CIRCULAR!
-
-	// Solution: Define interface in a separate package or keep it simple.
-	// Prompt says: "llm/backend/ (Backend interface...)"
-	// "tensor ... Ops ... matmul ..."
-	// If tensor ops call backend, backend cannot import tensor.
-	// We can use interface{} or a reduced type.
-	// OR `llm/tensor` defines the interface and `llm/backend` implements it?
-	// But `llm/backend` is a separate folder.
-
-	// Best approach:
-	// `llm/tensor` does not import `llm/backend`.
-	// `llm/tensor` has a variable `MatMulImpl func(a, b *NDArray) *NDArray`
-	// `llm/backend` sets this variable in `init()`.
-	// But `llm/backend` must import `llm/tensor` to see struct layout.
-	// This works.
+	Name() string
+
+	// MatMul: [..., M, K] x [..., K, N] -> [..., M, N]
+	MatMul(a, b *tensor.NDArray) *tensor.NDArray
+	// BatchedMatMul computes op(a) x op(b), where op swaps the last two
+	// dims when the corresponding trans flag is set.
+	BatchedMatMul(a, b *tensor.NDArray, transA, transB bool) *tensor.NDArray
+
+	Softmax(x *tensor.NDArray) *tensor.NDArray
+	GELU(x *tensor.NDArray) *tensor.NDArray
+	GELUBackward(gradOutput, x *tensor.NDArray) *tensor.NDArray
+	// LayerNorm returns y and the per-row mean and 1/std (see tensor.LayerNorm).
+	LayerNorm(x, gamma, beta *tensor.NDArray, eps float32) (*tensor.NDArray, []float32, []float32)
+
+	Add(a, b *tensor.NDArray) *tensor.NDArray
+	Sub(a, b *tensor.NDArray) *tensor.NDArray
+	Mul(a, b *tensor.NDArray) *tensor.NDArray
+	Div(a, b *tensor.NDArray) *tensor.NDArray
+}
+
+var registry = make(map[string]Backend)
+
+// Current is the backend used by the package-level dispatch functions.
+// Change it with Use.
+var Current Backend = &ParallelBackend{}
+
+func init() {
+	Register(&PureGoBackend{})
+	Register(Current)
+}
+
+// Register makes b selectable by name. It panics on duplicate names.
+func Register(b Backend) {
+	if _, ok := registry[b.Name()]; ok {
+		panic(fmt.Sprintf("backend %q registered twice", b.Name()))
+	}
+	registry[b.Name()] = b
+}
+
+// Get returns the backend registered under name.
+func Get(name string) (Backend, error) {
+	b, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown backend %q (available: %v)", name, Names())
+	}
+	return b, nil
+}
+
+// Names lists the registered backends in sorted order.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Use selects the backend named name. tensor.MatMul is routed to it as well,
+// so code calling the tensor package directly follows the selection.
+func Use(name string) error {
+	b, err := Get(name)
+	if err != nil {
+		return err
+	}
+	Current = b
+	tensor.MatMulImpl = b.MatMul
+	return nil
+}
+
+// Dispatch helpers: shorthand for Current.X.
+
+func MatMul(a, b *tensor.NDArray) *tensor.NDArray {
+	return Current.MatMul(a, b)
+}
+
+func BatchedMatMul(a, b *tensor.NDArray, transA, transB bool) *tensor.NDArray {
+	return Current.BatchedMatMul(a, b, transA, transB)
+}
+
+func Softmax(x *tensor.NDArray) *tensor.NDArray {
+	return Current.Softmax(x)
+}
+
+func GELU(x *tensor.NDArray) *tensor.NDArray {
+	return Current.GELU(x)
+}
+
+func GELUBackward(gradOutput, x *tensor.NDArray) *tensor.NDArray {
+	return Current.GELUBackward(gradOutput, x)
+}
+
+func LayerNorm(x, gamma, beta *tensor.NDArray, eps float32) (*tensor.NDArray, []float32, []float32) {
+	return Current.LayerNorm(x, gamma, beta, eps)
+}
+
+func Add(a, b *tensor.NDArray) *tensor.NDArray {
+	return Current.Add(a, b)
+}
+
+func Sub(a, b *tensor.NDArray) *tensor.NDArray {
+	return Current.Sub(a, b)
+}
+
+func Mul(a, b *tensor.NDArray) *tensor.NDArray {
+	return Current.Mul(a, b)
+}
+
+func Div(a, b *tensor.NDArray) *tensor.NDArray {
+	return Current.Div(a, b)
 }
@@ -0,0 +1,121 @@
+package backend
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/brucetruth/minigpt/llm/tensor"
+)
+
+// conformanceBackends is every registered backend plus configurations that
+// force the parallel code paths even on a single CPU.
+func conformanceBackends() []Backend {
+	var out []Backend
+	for _, name := range Names() {
+		b, _ := Get(name)
+		out = append(out, b)
+	}
+	return append(out, &ParallelBackend{Workers: 3})
+}
+
+func randomArray(shape ...int) *tensor.NDArray {
+	t := tensor.New(shape...)
+	for i := range t.Data {
+		t.Data[i] = rand.Float32()*4 - 2
+	}
+	return t
+}
+
+func assertClose(t *testing.T, what string, want, got *tensor.NDArray) {
+	t.Helper()
+	if len(want.Shape) != len(got.Shape) {
+		t.Fatalf("%s: expected shape %v, got %v", what, want.Shape, got.Shape)
+	}
+	for i := range want.Shape {
+		if want.Shape[i] != got.Shape[i] {
+			t.Fatalf("%s: expected shape %v, got %v", what, want.Shape, got.Shape)
+		}
+	}
+	assertSliceClose(t, what, want.Data, got.Data)
+}
+
+func assertSliceClose(t *testing.T, what string, want, got []float32) {
+	t.Helper()
+	if len(want) != len(got) {
+		t.Fatalf("%s: expected %d values, got %d", what, len(want), len(got))
+	}
+	for i, w := range want {
+		tol := 1e-4 * math.Max(1, math.Abs(float64(w)))
+		if math.Abs(float64(w-got[i])) > tol {
+			t.Fatalf("%s at %d: expected %f, got %f", what, i, w, got[i])
+		}
+	}
+}
+
+func TestConformance(t *testing.T) {
+	rand.Seed(1)
+
+	for _, be := range conformanceBackends() {
+		t.Run(be.Name(), func(t *testing.T) {
+			// MatMul, including a large enough case to go parallel
+			for _, s := range [][3]int{{1, 1, 1}, {3, 5, 2}, {67, 129, 33}} {
+				m, k, n := s[0], s[1], s[2]
+				a := randomArray(2, m, k)
+				b := randomArray(2, k, n)
+				assertClose(t, "MatMul", tensor.NaiveMatMul(a, b), be.MatMul(a, b))
+			}
+
+			// BatchedMatMul for every transpose combination
+			a := randomArray(3, 4, 7, 5)
+			bNN := randomArray(3, 4, 5, 6)
+			want := tensor.NaiveMatMul(a, bNN)
+			at := tensor.Transpose(a)
+			bt := tensor.Transpose(bNN)
+			assertClose(t, "BatchedMatMul NN", want, be.BatchedMatMul(a, bNN, false, false))
+			assertClose(t, "BatchedMatMul NT", want, be.BatchedMatMul(a, bt, false, true))
+			assertClose(t, "BatchedMatMul TN", want, be.BatchedMatMul(at, bNN, true, false))
+			assertClose(t, "BatchedMatMul TT", want, be.BatchedMatMul(at, bt, true, true))
+
+			// Row-wise and elementwise ops on small and parallel-sized inputs
+			for _, shape := range [][]int{{1, 3}, {4, 9, 17}, {64, 1024}} {
+				x := randomArray(shape...)
+				y := randomArray(shape...)
+				for i := range y.Data {
+					y.Data[i] += 3 // Keep Div well away from zero
+				}
+
+				assertClose(t, "Softmax", tensor.Softmax(x), be.Softmax(x))
+				assertClose(t, "GELU", tensor.GELU(x), be.GELU(x))
+				assertClose(t, "GELUBackward", tensor.GELUBackward(y, x), be.GELUBackward(y, x))
+				assertClose(t, "Add", tensor.Add(x, y), be.Add(x, y))
+				assertClose(t, "Sub", tensor.Sub(x, y), be.Sub(x, y))
+				assertClose(t, "Mul", tensor.Mul(x, y), be.Mul(x, y))
+				assertClose(t, "Div", tensor.Div(x, y), be.Div(x, y))
+
+				dim := shape[len(shape)-1]
+				gamma := randomArray(dim)
+				beta := randomArray(dim)
+				wantOut, wantMean, wantRstd := tensor.LayerNorm(x, gamma, beta, 1e-5)
+				gotOut, gotMean, gotRstd := be.LayerNorm(x, gamma, beta, 1e-5)
+				assertClose(t, "LayerNorm", wantOut, gotOut)
+				assertSliceClose(t, "LayerNorm mean", wantMean, gotMean)
+				assertSliceClose(t, "LayerNorm rstd", wantRstd, gotRstd)
+			}
+		})
+	}
+}
+
+func TestUse(t *testing.T) {
+	defer func(b Backend) { Current = b; tensor.MatMulImpl = b.MatMul }(Current)
+
+	if err := Use("purego"); err != nil {
+		t.Fatal(err)
+	}
+	if Current.Name() != "purego" {
+		t.Errorf("Expected purego, got %s", Current.Name())
+	}
+	if err := Use("no-such-backend"); err == nil {
+		t.Error("Expected error for unknown backend")
+	}
+}
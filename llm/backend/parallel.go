@@ -0,0 +1,158 @@
+package backend
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/brucetruth/minigpt/llm/tensor"
+)
+
+// Elementwise work below this many values stays on one goroutine.
+const minParallelElems = 1 << 14
+
+// ParallelBackend splits every op into disjoint row (or element) ranges and
+// runs them on Workers goroutines. Each output value is computed by exactly
+// one goroutine with the same code as the reference, so results match
+// PureGoBackend bit for bit.
+type ParallelBackend struct {
+	Workers int // 0 means tensor.MatMulWorkers, or runtime.GOMAXPROCS(0) if that is 0 too
+}
+
+func (b *ParallelBackend) Name() string { return "parallel" }
+
+func (b *ParallelBackend) workers() int {
+	if b.Workers > 0 {
+		return b.Workers
+	}
+	if tensor.MatMulWorkers > 0 {
+		return tensor.MatMulWorkers
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+func (b *ParallelBackend) MatMul(x, y *tensor.NDArray) *tensor.NDArray {
+	return tensor.ParallelMatMul(x, y, b.workers())
+}
+
+func (b *ParallelBackend) BatchedMatMul(x, y *tensor.NDArray, transA, transB bool) *tensor.NDArray {
+	return tensor.BatchedMatMul(x, y, transA, transB, b.workers())
+}
+
+func (b *ParallelBackend) Softmax(x *tensor.NDArray) *tensor.NDArray {
+	out := tensor.New(x.Shape...)
+	b.forRows(x, func(lo, hi int) {
+		tensor.SoftmaxInto(rows(out, lo, hi), rows(x, lo, hi))
+	})
+	return out
+}
+
+func (b *ParallelBackend) GELU(x *tensor.NDArray) *tensor.NDArray {
+	out := tensor.New(x.Shape...)
+	b.forElems(x.Size, func(lo, hi int) {
+		tensor.GELUInto(elems(out, lo, hi), elems(x, lo, hi))
+	})
+	return out
+}
+
+func (b *ParallelBackend) GELUBackward(gradOutput, x *tensor.NDArray) *tensor.NDArray {
+	out := tensor.New(x.Shape...)
+	b.forElems(x.Size, func(lo, hi int) {
+		tensor.GELUBackwardInto(elems(out, lo, hi), elems(gradOutput, lo, hi), elems(x, lo, hi))
+	})
+	return out
+}
+
+func (b *ParallelBackend) LayerNorm(x, gamma, beta *tensor.NDArray, eps float32) (*tensor.NDArray, []float32, []float32) {
+	nRows := x.Size / gamma.Size
+	out := tensor.New(x.Shape...)
+	mean := make([]float32, nRows)
+	rstd := make([]float32, nRows)
+	b.forRows(x, func(lo, hi int) {
+		tensor.LayerNormInto(rows(out, lo, hi), rows(x, lo, hi), gamma, beta, eps, mean[lo:hi], rstd[lo:hi])
+	})
+	return out, mean, rstd
+}
+
+func (b *ParallelBackend) Add(x, y *tensor.NDArray) *tensor.NDArray {
+	return b.elementwise(x, y, tensor.AddInto)
+}
+
+func (b *ParallelBackend) Sub(x, y *tensor.NDArray) *tensor.NDArray {
+	return b.elementwise(x, y, tensor.SubInto)
+}
+
+func (b *ParallelBackend) Mul(x, y *tensor.NDArray) *tensor.NDArray {
+	if len(x.Data) != len(y.Data) {
+		panic("shape mismatch in Mul")
+	}
+	return b.elementwise(x, y, tensor.MulInto)
+}
+
+func (b *ParallelBackend) Div(x, y *tensor.NDArray) *tensor.NDArray {
+	return b.elementwise(x, y, tensor.DivInto)
+}
+
+func (b *ParallelBackend) elementwise(x, y *tensor.NDArray, op func(out, x, y *tensor.NDArray)) *tensor.NDArray {
+	out := tensor.New(x.Shape...)
+	b.forElems(out.Size, func(lo, hi int) {
+		op(elems(out, lo, hi), elems(x, lo, hi), elems(y, lo, hi))
+	})
+	return out
+}
+
+// forRows runs fn over ranges of rows (last-dim slices) of x.
+func (b *ParallelBackend) forRows(x *tensor.NDArray, fn func(lo, hi int)) {
+	dim := x.Shape[len(x.Shape)-1]
+	nRows := x.Size / dim
+	minRows := max(1, minParallelElems/max(dim, 1))
+	parallelFor(nRows, minRows, b.workers(), fn)
+}
+
+// forElems runs fn over ranges of n flat elements.
+func (b *ParallelBackend) forElems(n int, fn func(lo, hi int)) {
+	parallelFor(n, minParallelElems, b.workers(), fn)
+}
+
+// parallelFor splits [0, n) into at most workers contiguous chunks of at
+// least minChunk items and runs fn on each concurrently.
+func parallelFor(n, minChunk, workers int, fn func(lo, hi int)) {
+	chunks := min(workers, (n+minChunk-1)/minChunk)
+	if chunks <= 1 {
+		fn(0, n)
+		return
+	}
+
+	size := (n + chunks - 1) / chunks
+	var wg sync.WaitGroup
+	for lo := 0; lo < n; lo += size {
+		hi := min(lo+size, n)
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			fn(lo, hi)
+		}(lo, hi)
+	}
+	wg.Wait()
+}
+
+// rows returns rows lo..hi-1 of t (split on the last dim) as a 2D view.
+func rows(t *tensor.NDArray, lo, hi int) *tensor.NDArray {
+	dim := t.Shape[len(t.Shape)-1]
+	return view(t.Data[lo*dim:hi*dim], hi-lo, dim)
+}
+
+// elems returns flat elements lo..hi-1 of t as a 1D view.
+func elems(t *tensor.NDArray, lo, hi int) *tensor.NDArray {
+	return view(t.Data[lo:hi], hi-lo)
+}
+
+func view(data []float32, shape ...int) *tensor.NDArray {
+	t := &tensor.NDArray{Data: data, Shape: shape, Size: len(data)}
+	t.Strides = make([]int, len(shape))
+	stride := 1
+	for i := len(shape) - 1; i >= 0; i-- {
+		t.Strides[i] = stride
+		stride *= shape[i]
+	}
+	return t
+}
@@ -0,0 +1,41 @@
+package backend
+
+import (
+	"github.com/brucetruth/minigpt/llm/tensor"
+)
+
+// PureGoBackend runs every op single-threaded on the calling goroutine.
+// MatMul uses the cache-blocked kernel with one worker; transposed operands
+// are read in place rather than copied.
+type PureGoBackend struct{}
+
+func (b *PureGoBackend) Name() string { return "purego" }
+
+func (b *PureGoBackend) MatMul(x, y *tensor.NDArray) *tensor.NDArray {
+	return tensor.ParallelMatMul(x, y, 1)
+}
+
+func (b *PureGoBackend) BatchedMatMul(x, y *tensor.NDArray, transA, transB bool) *tensor.NDArray {
+	return tensor.BatchedMatMul(x, y, transA, transB, 1)
+}
+
+func (b *PureGoBackend) Softmax(x *tensor.NDArray) *tensor.NDArray {
+	return tensor.Softmax(x)
+}
+
+func (b *PureGoBackend) GELU(x *tensor.NDArray) *tensor.NDArray {
+	return tensor.GELU(x)
+}
+
+func (b *PureGoBackend) GELUBackward(gradOutput, x *tensor.NDArray) *tensor.NDArray {
+	return tensor.GELUBackward(gradOutput, x)
+}
+
+func (b *PureGoBackend) LayerNorm(x, gamma, beta *tensor.NDArray, eps float32) (*tensor.NDArray, []float32, []float32) {
+	return tensor.LayerNorm(x, gamma, beta, eps)
+}
+
+func (b *PureGoBackend) Add(x, y *tensor.NDArray) *tensor.NDArray { return tensor.Add(x, y) }
+func (b *PureGoBackend) Sub(x, y *tensor.NDArray) *tensor.NDArray { return tensor.Sub(x, y) }
+func (b *PureGoBackend) Mul(x, y *tensor.NDArray) *tensor.NDArray { return tensor.Mul(x, y) }
+func (b *PureGoBackend) Div(x, y *tensor.NDArray) *tensor.NDArray { return tensor.Div(x, y) }
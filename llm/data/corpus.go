@@ -0,0 +1,121 @@
+package data
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ExpandPaths resolves corpus paths to document files, in order. Each
+// pattern is a file, a glob or a directory, which contributes every
+// non-hidden file below it in lexical order. A pattern matching nothing is
+// an error.
+func ExpandPaths(patterns []string) ([]string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%s: no such file", pattern)
+		}
+		for _, m := range matches {
+			info, err := os.Stat(m)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				files = append(files, m)
+				continue
+			}
+			var found []string
+			err = filepath.WalkDir(m, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if path != m && strings.HasPrefix(d.Name(), ".") {
+					if d.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if !d.IsDir() {
+					found = append(found, path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			sort.Strings(found)
+			files = append(files, found...)
+		}
+	}
+	return files, nil
+}
+
+// OpenDocument opens a document file, decompressing it if it is gzipped.
+func OpenDocument(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(f)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return readCloser{zr, func() error {
+			zr.Close()
+			return f.Close()
+		}}, nil
+	}
+	return readCloser{br, f.Close}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (rc readCloser) Close() error { return rc.close() }
+
+// ReadDocuments reads each file as one document.
+func ReadDocuments(paths []string) ([]string, error) {
+	docs := make([]string, 0, len(paths))
+	for _, path := range paths {
+		rc, err := OpenDocument(path)
+		if err != nil {
+			return nil, err
+		}
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		docs = append(docs, string(b))
+	}
+	return docs, nil
+}
+
+// DocStarts returns the offset of each document in tokens joined by sep:
+// 0 and the position after every separator. A document owns its trailing
+// separator, so the model still learns to end documents.
+func DocStarts(tokens []int, sep int) []int {
+	starts := []int{0}
+	for i, id := range tokens[:max(len(tokens)-1, 0)] {
+		if id == sep {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
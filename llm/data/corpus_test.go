@@ -0,0 +1,106 @@
+package data
+
+import (
+	"compress/gzip"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadCorpus(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("docs/b.txt", "bee")
+	write("docs/a/1.txt", "one")
+	write("docs/.hidden", "skipped")
+	write("extra.txt", "extra")
+
+	f, err := os.Create(filepath.Join(dir, "docs", "c.txt.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := gzip.NewWriter(f)
+	zw.Write([]byte("compressed"))
+	zw.Close()
+	f.Close()
+
+	paths, err := ExpandPaths([]string{filepath.Join(dir, "docs"), filepath.Join(dir, "*.txt")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs, err := ReadDocuments(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"one", "bee", "compressed", "extra"}; !reflect.DeepEqual(docs, want) {
+		t.Errorf("read %q, want %q", docs, want)
+	}
+
+	if _, err := ExpandPaths([]string{filepath.Join(dir, "missing*")}); err == nil {
+		t.Error("ExpandPaths accepted a pattern that matches nothing")
+	}
+}
+
+func TestDocumentWindows(t *testing.T) {
+	// Documents of 7, 3 (too short for a window) and 9 tokens, each ending
+	// in the separator 0; token values name their document.
+	const sep = 0
+	var tokens []int
+	for doc, n := range []int{7, 3, 9} {
+		for i := 0; i < n-1; i++ {
+			tokens = append(tokens, doc+1)
+		}
+		tokens = append(tokens, sep)
+	}
+	starts := DocStarts(tokens, sep)
+	if !reflect.DeepEqual(starts, []int{0, 7, 10}) {
+		t.Fatalf("DocStarts = %v", starts)
+	}
+
+	ds := NewTextDataset(tokens, 4)
+	ds.DocStarts = starts
+	inOneDoc := func(window []int) bool {
+		for _, id := range window[:len(window)-1] {
+			if id != window[0] {
+				return false
+			}
+		}
+		return window[0] != sep
+	}
+	check := func(name string, x []float32, y []int) {
+		for b := 0; b < len(y)/4; b++ {
+			window := []int{int(x[b*4])}
+			for _, id := range y[b*4 : b*4+4] {
+				window = append(window, id)
+			}
+			if !inOneDoc(window) {
+				t.Fatalf("%s window %v spans documents", name, window)
+			}
+		}
+	}
+
+	ds.Rand = rand.New(rand.NewSource(1))
+	x, y := ds.GetBatch(64)
+	check("random", x.Data, y)
+
+	it := NewIterator(ds, 4, 1)
+	if it.Windows() != 4 { // Offsets 0, 2 in the first document; 10, 14 in the last
+		t.Errorf("got %d windows, want 4", it.Windows())
+	}
+	x, y = it.GetBatch(8)
+	check("epoch", x.Data, y)
+
+	// Split keeps the boundaries that fall inside each side
+	train, val := Split(ds, 4, 0.5)
+	if !reflect.DeepEqual(train.Documents(), []int{0, 7}) || !reflect.DeepEqual(val.Documents(), []int{0}) {
+		t.Errorf("split documents %v and %v", train.Documents(), val.Documents())
+	}
+}
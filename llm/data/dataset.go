@@ -6,9 +6,35 @@ import (
 	"github.com/brucetruth/minigpt/llm/tensor"
 )
 
+// Dataset yields training batches: x [B, T] token ids and the targets y,
+// x shifted by one token.
+type Dataset interface {
+	GetBatch(batchSize int) (*tensor.NDArray, []int)
+}
+
+// TokenSource is random access to a token sequence. TextDataset,
+// ShardDataset and Range are token sources.
+type TokenSource interface {
+	Len() int
+	// ReadTokens copies the tokens at [offset, offset+len(dst)) into dst.
+	ReadTokens(dst []int, offset int)
+}
+
+// documented is a token source that knows where its documents start.
+// Windows drawn from it stay inside single documents.
+type documented interface {
+	Documents() []int
+}
+
 type TextDataset struct {
 	Tokens    []int
 	BlockSize int
+	Rand      *rand.Rand // Offset source; nil uses the global math/rand source
+
+	// DocStarts, if set, are the ascending offsets of the documents in
+	// Tokens (see DocStarts); windows then never span two documents.
+	// Documents shorter than a window are not sampled.
+	DocStarts []int
 }
 
 func NewTextDataset(tokens []int, blockSize int) *TextDataset {
@@ -18,33 +44,192 @@ func NewTextDataset(tokens []int, blockSize int) *TextDataset {
 	}
 }
 
+// Len is the number of tokens.
+func (ds *TextDataset) Len() int {
+	return len(ds.Tokens)
+}
+
+func (ds *TextDataset) ReadTokens(dst []int, offset int) {
+	copy(dst, ds.Tokens[offset:])
+}
+
+func (ds *TextDataset) Documents() []int {
+	return ds.DocStarts
+}
+
 // GetBatch returns (x, y) tensors.
 // x: [B, T], y: [B, T] (shifted)
 func (ds *TextDataset) GetBatch(batchSize int) (*tensor.NDArray, []int) {
-	x := tensor.New(batchSize, ds.BlockSize)
-	y := make([]int, batchSize*ds.BlockSize)
+	return ds.plan(batchSize).build()
+}
+
+func (ds *TextDataset) plan(batchSize int) batchPlan {
+	return planRandom(ds, ds.BlockSize, batchSize, ds.Rand)
+}
+
+// planner is a dataset that can choose the windows of its next batch
+// separately from reading them, so a Loader can build batches concurrently.
+type planner interface {
+	plan(batchSize int) batchPlan
+}
+
+// batchPlan is the windows of one batch.
+type batchPlan struct {
+	blockSize int
+	rows      []planRow // Fewer than the batch size leaves rows of zeros
+	batchSize int
+}
+
+// planRow is a window of blockSize+1 tokens at offset of src, or an already
+// built row if src is nil.
+type planRow struct {
+	src    TokenSource
+	offset int
+	x      []float32
+	y      []int
+}
+
+// build reads the planned windows into (x, y) tensors.
+func (p batchPlan) build() (*tensor.NDArray, []int) {
+	x := tensor.New(p.batchSize, p.blockSize)
+	y := make([]int, p.batchSize*p.blockSize)
+	window := make([]int, p.blockSize+1)
+	for b, row := range p.rows {
+		if row.src == nil {
+			copy(x.Data[b*p.blockSize:], row.x)
+			copy(y[b*p.blockSize:], row.y)
+			continue
+		}
+		row.src.ReadTokens(window, row.offset)
+		fillWindow(x, y, b, window)
+	}
+	return x, y
+}
+
+// planRandom picks batchSize windows of blockSize+1 tokens at random
+// offsets of src.
+func planRandom(src TokenSource, blockSize, batchSize int, rng *rand.Rand) batchPlan {
+	p := batchPlan{blockSize: blockSize, batchSize: batchSize}
 
-	maxOffset := len(ds.Tokens) - ds.BlockSize - 1
-	if maxOffset <= 0 {
-		return x, y // Empty or error
+	// Every offset whose window fits, including the last
+	spans := windowSpans(src, blockSize)
+	windows := 0
+	for _, sp := range spans {
+		windows += sp.n
+	}
+	if windows == 0 {
+		return p // Empty or error
 	}
 
 	for b := 0; b < batchSize; b++ {
-		offset := rand.Intn(maxOffset)
+		var i int
+		if rng != nil {
+			i = rng.Intn(windows)
+		} else {
+			i = rand.Intn(windows)
+		}
+		offset := 0
+		for _, sp := range spans {
+			if i < sp.n {
+				offset = sp.start + i
+				break
+			}
+			i -= sp.n
+		}
+		p.rows = append(p.rows, planRow{src: src, offset: offset})
+	}
+	return p
+}
+
+// span is a run of n consecutive window offsets from start.
+type span struct{ start, n int }
+
+// windowSpans returns the offsets at which a window of blockSize+1 tokens
+// fits in src, inside a single document if src knows its documents.
+func windowSpans(src TokenSource, blockSize int) []span {
+	starts := []int{0}
+	if d, ok := src.(documented); ok && d.Documents() != nil {
+		starts = d.Documents()
+	}
+	var spans []span
+	for i, start := range starts {
+		end := src.Len()
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		if n := end - start - blockSize; n > 0 {
+			spans = append(spans, span{start, n})
+		}
+	}
+	return spans
+}
+
+// HasWindow reports whether a window of blockSize+1 tokens fits in src,
+// inside a single document if src knows its documents. Sources without one
+// cannot fill a batch.
+func HasWindow(src TokenSource, blockSize int) bool {
+	return len(windowSpans(src, blockSize)) > 0
+}
 
-		// Fill x and y
-		for t := 0; t < ds.BlockSize; t++ {
-			token := ds.Tokens[offset+t]
-			target := ds.Tokens[offset+t+1]
+// fillWindow writes window (blockSize+1 tokens) as row b of x and its
+// targets, the same tokens shifted by one, into y.
+func fillWindow(x *tensor.NDArray, y []int, b int, window []int) {
+	blockSize := len(window) - 1
+	// Embedding casts the float32 ids in x back to int
+	for t := 0; t < blockSize; t++ {
+		x.Data[b*blockSize+t] = float32(window[t])
+		y[b*blockSize+t] = window[t+1]
+	}
+}
+
+// Range is a dataset over the tokens [Start, End) of a token source, e.g.
+// one side of a train/validation Split.
+type Range struct {
+	Source     TokenSource
+	Start, End int
+	BlockSize  int
+	Rand       *rand.Rand // Offset source; nil uses the global math/rand source
+}
+
+// Split divides src into a training Range over the leading tokens and a
+// validation Range over the trailing valFraction of them.
+func Split(src TokenSource, blockSize int, valFraction float64) (train, val *Range) {
+	n := src.Len()
+	cut := n - int(float64(n)*valFraction)
+	return &Range{Source: src, End: cut, BlockSize: blockSize},
+		&Range{Source: src, Start: cut, End: n, BlockSize: blockSize}
+}
+
+// Len is the number of tokens in the range.
+func (r *Range) Len() int {
+	return r.End - r.Start
+}
 
-			x.Data[b*ds.BlockSize+t] = float32(token) // Embedding expects float indices if using Gather? No, we use Ints usually
-			// Our Embedding.ForwardIndices takes []int.
-			// However, our standard pipeline might pass NDArray.
-			// We made GPT.Forward take NDArray[float32], but internally cast to int.
+func (r *Range) ReadTokens(dst []int, offset int) {
+	r.Source.ReadTokens(dst, r.Start+offset)
+}
 
-			y[b*ds.BlockSize+t] = target
+// Documents returns the source's document starts inside the range, relative
+// to Start, or nil if the source does not know its documents.
+func (r *Range) Documents() []int {
+	d, ok := r.Source.(documented)
+	if !ok || d.Documents() == nil {
+		return nil
+	}
+	starts := []int{0}
+	for _, s := range d.Documents() {
+		if s > r.Start && s < r.End {
+			starts = append(starts, s-r.Start)
 		}
 	}
+	return starts
+}
 
-	return x, y
+// GetBatch returns (x, y) tensors like TextDataset.GetBatch.
+func (r *Range) GetBatch(batchSize int) (*tensor.NDArray, []int) {
+	return r.plan(batchSize).build()
+}
+
+func (r *Range) plan(batchSize int) batchPlan {
+	return planRandom(r, r.BlockSize, batchSize, r.Rand)
 }
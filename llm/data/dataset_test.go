@@ -0,0 +1,62 @@
+package data
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tokens := make([]int, 100)
+	for i := range tokens {
+		tokens[i] = i
+	}
+	train, val := Split(NewTextDataset(tokens, 4), 4, 0.1)
+	if train.Len() != 90 || val.Len() != 10 {
+		t.Fatalf("split 100 tokens into %d and %d, want 90 and 10", train.Len(), val.Len())
+	}
+
+	// Windows stay inside their side of the split
+	val.Rand = rand.New(rand.NewSource(1))
+	x, y := val.GetBatch(8)
+	for i, id := range x.Data {
+		if id < 90 || y[i] != int(id)+1 {
+			t.Fatalf("validation window contains %v -> %d", id, y[i])
+		}
+	}
+	train.Rand = rand.New(rand.NewSource(1))
+	_, y = train.GetBatch(64)
+	for _, id := range y {
+		if id >= 90 {
+			t.Fatalf("training window contains validation token %d", id)
+		}
+	}
+}
+
+func TestSampleBatchReachesLastWindow(t *testing.T) {
+	// 6 tokens and block size 4: windows start at 0 and 1
+	ds := NewTextDataset([]int{0, 1, 2, 3, 4, 5}, 4)
+	ds.Rand = rand.New(rand.NewSource(1))
+	x, y := ds.GetBatch(32)
+	starts := map[float32]bool{}
+	for b := 0; b < 32; b++ {
+		starts[x.Data[b*4]] = true
+		if y[b*4+3] > 5 {
+			t.Fatalf("target %d past the end", y[b*4+3])
+		}
+	}
+	if !starts[0] || !starts[1] || len(starts) != 2 {
+		t.Errorf("sampled window starts %v, want 0 and 1", starts)
+	}
+}
+
+func TestHasWindow(t *testing.T) {
+	ds := NewTextDataset([]int{0, 1, 2, 3, 4}, 4)
+	if !HasWindow(ds, 4) || HasWindow(ds, 5) {
+		t.Error("5 tokens should hold exactly one window of block size 4")
+	}
+	// Documents too short for a window
+	ds.DocStarts = []int{0, 3}
+	if HasWindow(ds, 4) {
+		t.Error("found a window across documents")
+	}
+}
@@ -0,0 +1,92 @@
+package data
+
+import (
+	"math/rand"
+
+	"github.com/brucetruth/minigpt/llm/tensor"
+)
+
+// IteratorState is the position of an Iterator, for checkpointing.
+type IteratorState struct {
+	Epoch int // Completed passes over the data
+	Pos   int // Windows already returned in the current epoch
+}
+
+// Iterator returns every window of a token source once per epoch, in an
+// order shuffled by a seeded stream per epoch. Windows start every
+// BlockSize tokens, plus one ending at the last token, so each token is
+// seen at least once per epoch. Sources that know their documents (see
+// TextDataset.DocStarts) are windowed per document.
+type Iterator struct {
+	Source    TokenSource
+	BlockSize int
+	Seed      int64
+
+	state   IteratorState
+	offsets []int // Window offsets in the current epoch's order
+}
+
+// NewIterator returns an iterator at the start of epoch 0.
+func NewIterator(src TokenSource, blockSize int, seed int64) *Iterator {
+	it := &Iterator{Source: src, BlockSize: blockSize, Seed: seed}
+	it.shuffle()
+	return it
+}
+
+// Windows is the number of windows in an epoch.
+func (it *Iterator) Windows() int {
+	return len(it.offsets)
+}
+
+// State returns the current position.
+func (it *Iterator) State() IteratorState {
+	return it.state
+}
+
+// SetState moves to a position previously returned by State; the next
+// batch continues exactly where that iterator left off.
+func (it *Iterator) SetState(st IteratorState) {
+	it.state = st
+	it.shuffle()
+}
+
+// shuffle lays out the current epoch's windows.
+func (it *Iterator) shuffle() {
+	it.offsets = it.offsets[:0]
+	for _, sp := range windowSpans(it.Source, it.BlockSize) {
+		last := sp.start + sp.n - 1
+		for off := sp.start; off < last; off += it.BlockSize {
+			it.offsets = append(it.offsets, off)
+		}
+		it.offsets = append(it.offsets, last)
+	}
+
+	// Each epoch's order depends only on the seed and the epoch number
+	rng := rand.New(tensor.NewRNGSource(it.Seed + int64(it.state.Epoch)))
+	rng.Shuffle(len(it.offsets), func(i, j int) {
+		it.offsets[i], it.offsets[j] = it.offsets[j], it.offsets[i]
+	})
+}
+
+// GetBatch returns the next batchSize windows as (x, y) tensors like
+// TextDataset.GetBatch, moving on to the next epoch when this one runs out.
+func (it *Iterator) GetBatch(batchSize int) (*tensor.NDArray, []int) {
+	return it.plan(batchSize).build()
+}
+
+func (it *Iterator) plan(batchSize int) batchPlan {
+	p := batchPlan{blockSize: it.BlockSize, batchSize: batchSize}
+	if len(it.offsets) == 0 {
+		return p // Empty or error
+	}
+
+	for b := 0; b < batchSize; b++ {
+		if it.state.Pos == len(it.offsets) {
+			it.state = IteratorState{Epoch: it.state.Epoch + 1}
+			it.shuffle()
+		}
+		p.rows = append(p.rows, planRow{src: it.Source, offset: it.offsets[it.state.Pos]})
+		it.state.Pos++
+	}
+	return p
+}
@@ -0,0 +1,69 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIterator(t *testing.T) {
+	tokens := make([]int, 103)
+	for i := range tokens {
+		tokens[i] = i
+	}
+	src := NewTextDataset(tokens, 10)
+	it := NewIterator(src, 10, 5)
+	if it.Windows() != 11 { // Offsets 0, 10, ..., 90 and the last, 92
+		t.Fatalf("got %d windows, want 11", it.Windows())
+	}
+
+	// One epoch sees every window once and every token
+	starts := map[int]bool{}
+	seen := map[int]bool{}
+	var epoch0 []int
+	for i := 0; i < it.Windows(); i++ {
+		x, y := it.GetBatch(1)
+		start := int(x.Data[0])
+		if starts[start] {
+			t.Fatalf("window at %d returned twice in an epoch", start)
+		}
+		starts[start] = true
+		epoch0 = append(epoch0, start)
+		for i, id := range x.Data {
+			seen[int(id)], seen[y[i]] = true, true
+		}
+	}
+	if len(seen) != len(tokens) || !starts[92] {
+		t.Errorf("epoch saw %d of %d tokens, last window %v", len(seen), len(tokens), starts[92])
+	}
+	if st := it.State(); st.Epoch != 0 || st.Pos != it.Windows() {
+		t.Errorf("state after one epoch %+v", st)
+	}
+
+	// Batches run on into the next epoch, in a different order
+	x, _ := it.GetBatch(3)
+	if st := it.State(); st.Epoch != 1 || st.Pos != 3 {
+		t.Errorf("state after crossing an epoch %+v", st)
+	}
+
+	// A restored iterator continues exactly, and the same seed reproduces
+	// the first epoch
+	resumed := NewIterator(src, 10, 5)
+	resumed.SetState(it.State())
+	want, _ := it.GetBatch(4)
+	got, _ := resumed.GetBatch(4)
+	if !reflect.DeepEqual(want.Data, got.Data) {
+		t.Errorf("restored iterator returned %v, want %v", got.Data, want.Data)
+	}
+	again := NewIterator(src, 10, 5)
+	var epoch1 []int
+	for i := 0; i < it.Windows(); i++ {
+		x, _ := again.GetBatch(1)
+		epoch1 = append(epoch1, int(x.Data[0]))
+	}
+	if !reflect.DeepEqual(epoch0, epoch1) {
+		t.Errorf("same seed gave orders %v and %v", epoch0, epoch1)
+	}
+	if int(x.Data[0]) == epoch0[0] && int(x.Data[10]) == epoch0[1] && int(x.Data[20]) == epoch0[2] {
+		t.Errorf("epoch 1 starts like epoch 0: %v", epoch0[:3])
+	}
+}
@@ -0,0 +1,120 @@
+package data
+
+import (
+	"sync"
+
+	"github.com/brucetruth/minigpt/llm/tensor"
+)
+
+// Batch is one batch from a Loader.
+type Batch struct {
+	X *tensor.NDArray
+	Y []int
+
+	// State is what LoaderOptions.Snapshot returned right after this batch
+	// was drawn, e.g. the dataset's RNG and iterator position, so a
+	// checkpoint taken after training on it resumes with the next batch.
+	State any
+}
+
+// LoaderOptions configures a Loader.
+type LoaderOptions struct {
+	Prefetch int // Batches prepared ahead of Next; at least 1
+	Workers  int // Goroutines reading tokens into batches; at least 1
+
+	// Snapshot, if set, is called after each batch is drawn; see
+	// Batch.State. It runs on the loader's goroutine, which owns the
+	// dataset (and its Rand) until Close.
+	Snapshot func() any
+}
+
+// Loader prepares the batches of a dataset in the background. One goroutine
+// draws batches from the dataset in order, choosing their windows, and
+// Workers goroutines read the tokens; Next returns the batches in the order
+// they were drawn, so the sequence is the same as calling GetBatch directly
+// whatever the number of workers. Datasets other than the ones in this
+// package are built by the drawing goroutine.
+type Loader struct {
+	queue chan chan Batch // Results in draw order
+	done  chan struct{}
+	wg    sync.WaitGroup
+	once  sync.Once
+}
+
+// NewLoader starts prefetching batches of batchSize from ds. The dataset
+// must not be used by anything else until Close.
+func NewLoader(ds Dataset, batchSize int, opts LoaderOptions) *Loader {
+	prefetch, workers := max(opts.Prefetch, 1), max(opts.Workers, 1)
+	l := &Loader{
+		queue: make(chan chan Batch, prefetch),
+		done:  make(chan struct{}),
+	}
+
+	type job struct {
+		plan   batchPlan
+		state  any
+		result chan Batch
+	}
+	jobs := make(chan job, prefetch)
+
+	l.wg.Add(1 + workers)
+	go func() {
+		defer l.wg.Done()
+		defer close(jobs)
+		for {
+			j := job{result: make(chan Batch, 1)}
+			p, canPlan := ds.(planner)
+			var x *tensor.NDArray
+			var y []int
+			if canPlan {
+				j.plan = p.plan(batchSize)
+			} else {
+				x, y = ds.GetBatch(batchSize)
+			}
+			if opts.Snapshot != nil {
+				j.state = opts.Snapshot()
+			}
+			if !canPlan {
+				j.result <- Batch{X: x, Y: y, State: j.state}
+			}
+
+			select {
+			case l.queue <- j.result:
+			case <-l.done:
+				return
+			}
+			if canPlan {
+				select {
+				case jobs <- j:
+				case <-l.done:
+					return
+				}
+			}
+		}
+	}()
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer l.wg.Done()
+			for j := range jobs {
+				x, y := j.plan.build()
+				j.result <- Batch{X: x, Y: y, State: j.state}
+			}
+		}()
+	}
+	return l
+}
+
+// Next returns the next batch, waiting for it if it is not ready yet. It
+// must not be called after Close.
+func (l *Loader) Next() Batch {
+	return <-<-l.queue
+}
+
+// Close stops the loader and waits for its goroutines to exit. Batches
+// prepared but not taken are dropped. It is safe to call more than once.
+func (l *Loader) Close() {
+	l.once.Do(func() {
+		close(l.done)
+		l.wg.Wait()
+	})
+}
@@ -0,0 +1,78 @@
+package data
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/brucetruth/minigpt/llm/tensor"
+)
+
+// countingDataset is a Dataset from outside the package: batch i is all i.
+type countingDataset struct{ i int }
+
+func (c *countingDataset) GetBatch(batchSize int) (*tensor.NDArray, []int) {
+	x := tensor.New(batchSize, 2)
+	y := make([]int, batchSize*2)
+	for j := range y {
+		x.Data[j], y[j] = float32(c.i), c.i
+	}
+	c.i++
+	return x, y
+}
+
+func TestLoaderMatchesGetBatch(t *testing.T) {
+	tokens := make([]int, 500)
+	for i := range tokens {
+		tokens[i] = i
+	}
+	datasets := map[string]func() (Dataset, func() any){
+		"random": func() (Dataset, func() any) {
+			src := tensor.NewRNGSource(3)
+			ds := NewTextDataset(tokens, 8)
+			ds.Rand = rand.New(src)
+			return ds, func() any { return src.State() }
+		},
+		"epoch": func() (Dataset, func() any) {
+			it := NewIterator(NewTextDataset(tokens, 8), 8, 3)
+			return it, func() any { return it.State() }
+		},
+		"mixture": func() (Dataset, func() any) {
+			m, _ := NewMixture([]MixtureSource{
+				{Name: "a", Data: NewIterator(NewTextDataset(tokens[:300], 8), 8, 1), Weight: 1},
+				{Name: "b", Data: NewIterator(NewTextDataset(tokens[300:], 8), 8, 2), Weight: 1},
+			}, 1)
+			m.Rand = rand.New(rand.NewSource(4))
+			return m, func() any { return m.State() }
+		},
+		"external": func() (Dataset, func() any) {
+			c := &countingDataset{}
+			return c, func() any { return c.i }
+		},
+	}
+
+	for name, newDataset := range datasets {
+		ds, snapshot := newDataset()
+		var want []Batch
+		for i := 0; i < 20; i++ {
+			x, y := ds.GetBatch(5)
+			want = append(want, Batch{X: x, Y: y, State: snapshot()})
+		}
+
+		for _, workers := range []int{1, 4} {
+			ds, snapshot := newDataset()
+			l := NewLoader(ds, 5, LoaderOptions{Prefetch: 3, Workers: workers, Snapshot: snapshot})
+			for i, w := range want {
+				got := l.Next()
+				if !reflect.DeepEqual(got.X.Data, w.X.Data) || !reflect.DeepEqual(got.Y, w.Y) {
+					t.Fatalf("%s, %d workers: batch %d differs from GetBatch", name, workers, i)
+				}
+				if !reflect.DeepEqual(got.State, w.State) {
+					t.Fatalf("%s, %d workers: batch %d state %v, want %v", name, workers, i, got.State, w.State)
+				}
+			}
+			l.Close()
+			l.Close()
+		}
+	}
+}
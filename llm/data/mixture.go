@@ -0,0 +1,179 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/brucetruth/minigpt/llm/tensor"
+)
+
+// MixtureSource is one component of a Mixture.
+type MixtureSource struct {
+	Name   string
+	Data   Dataset
+	Weight float64 // Relative to the other sources; must be positive
+}
+
+// Mixture draws each window of a batch from one of several datasets, chosen
+// at random in proportion to their weights. A Temperature above 1 flattens
+// the proportions towards uniform, below 1 sharpens them.
+type Mixture struct {
+	Sources     []MixtureSource
+	Temperature float64    // 0 is the same as 1: weights as given
+	Rand        *rand.Rand // Source choice; nil uses the global math/rand source
+
+	tokens []int64
+}
+
+// MixtureState is the position of a Mixture, for checkpointing.
+type MixtureState struct {
+	Tokens    []int64         // Tokens drawn from each source
+	Iterators []IteratorState // Of the sources that are Iterators, in order
+}
+
+// NewMixture returns a mixture of sources.
+func NewMixture(sources []MixtureSource, temperature float64) (*Mixture, error) {
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("mixture needs at least one source")
+	}
+	for _, s := range sources {
+		if !(s.Weight > 0) {
+			return nil, fmt.Errorf("source %q: weight must be positive, got %g", s.Name, s.Weight)
+		}
+	}
+	if temperature < 0 {
+		return nil, fmt.Errorf("mixture temperature must not be negative, got %g", temperature)
+	}
+	return &Mixture{
+		Sources:     sources,
+		Temperature: temperature,
+		tokens:      make([]int64, len(sources)),
+	}, nil
+}
+
+// Probabilities returns the chance of drawing from each source:
+// Weight^(1/Temperature), normalized.
+func (m *Mixture) Probabilities() []float64 {
+	t := m.Temperature
+	if t == 0 {
+		t = 1
+	}
+	p := make([]float64, len(m.Sources))
+	var sum float64
+	for i, s := range m.Sources {
+		p[i] = math.Pow(s.Weight, 1/t)
+		sum += p[i]
+	}
+	for i := range p {
+		p[i] /= sum
+	}
+	return p
+}
+
+// Tokens returns the number of target tokens drawn from each source so far.
+func (m *Mixture) Tokens() []int64 {
+	return append([]int64(nil), m.tokens...)
+}
+
+// GetBatch returns (x, y) tensors like TextDataset.GetBatch, each window
+// taken from a randomly chosen source.
+func (m *Mixture) GetBatch(batchSize int) (*tensor.NDArray, []int) {
+	return m.plan(batchSize).build()
+}
+
+// plan picks a source per row and takes the source's next window. Sources
+// that cannot plan build their row right away. A source without a window is
+// left out and the row drawn again from the others, so the batch is only
+// short if every source is empty.
+func (m *Mixture) plan(batchSize int) batchPlan {
+	p := m.Probabilities()
+	live := make([]bool, len(p))
+	for i := range live {
+		live[i] = true
+	}
+	nLive, total := len(p), 1.0
+	plan := batchPlan{batchSize: batchSize}
+	for len(plan.rows) < batchSize && nLive > 0 {
+		i := m.draw(p, live, total)
+
+		var row planRow
+		if src, ok := m.Sources[i].Data.(planner); ok {
+			one := src.plan(1)
+			plan.blockSize = one.blockSize
+			if len(one.rows) == 0 {
+				live[i] = false // Empty source
+				nLive--
+				total = 0
+				for j, ok := range live {
+					if ok {
+						total += p[j]
+					}
+				}
+				continue
+			}
+			row = one.rows[0]
+		} else {
+			x, y := m.Sources[i].Data.GetBatch(1)
+			plan.blockSize = x.Shape[1]
+			row = planRow{x: x.Data, y: y}
+		}
+		plan.rows = append(plan.rows, row)
+		m.tokens[i] += int64(plan.blockSize)
+	}
+	return plan
+}
+
+// draw picks one of the live sources with probability p[i]/total, where
+// total is the sum of their probabilities. At least one must be live.
+func (m *Mixture) draw(p []float64, live []bool, total float64) int {
+	var r float64
+	if m.Rand != nil {
+		r = m.Rand.Float64()
+	} else {
+		r = rand.Float64()
+	}
+	r *= total
+	last := -1
+	for i, pi := range p {
+		if !live[i] {
+			continue
+		}
+		if r < pi {
+			return i
+		}
+		r -= pi
+		last = i
+	}
+	return last // Rounding
+}
+
+// State returns the current position.
+func (m *Mixture) State() MixtureState {
+	st := MixtureState{Tokens: m.Tokens()}
+	for _, s := range m.Sources {
+		if it, ok := s.Data.(*Iterator); ok {
+			st.Iterators = append(st.Iterators, it.State())
+		}
+	}
+	return st
+}
+
+// SetState restores a position returned by State for the same sources.
+func (m *Mixture) SetState(st MixtureState) error {
+	var iters []*Iterator
+	for _, s := range m.Sources {
+		if it, ok := s.Data.(*Iterator); ok {
+			iters = append(iters, it)
+		}
+	}
+	if len(st.Tokens) != len(m.Sources) || len(st.Iterators) != len(iters) {
+		return fmt.Errorf("mixture state for %d sources (%d iterators), have %d (%d)",
+			len(st.Tokens), len(st.Iterators), len(m.Sources), len(iters))
+	}
+	copy(m.tokens, st.Tokens)
+	for i, it := range iters {
+		it.SetState(st.Iterators[i])
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package data
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMixture(t *testing.T) {
+	// Each source's tokens are its own id
+	constant := func(id, n int) []int {
+		tokens := make([]int, n)
+		for i := range tokens {
+			tokens[i] = id
+		}
+		return tokens
+	}
+	sources := func() []MixtureSource {
+		return []MixtureSource{
+			{Name: "a", Data: NewIterator(NewTextDataset(constant(0, 200), 4), 4, 1), Weight: 3},
+			{Name: "b", Data: NewIterator(NewTextDataset(constant(1, 50), 4), 4, 2), Weight: 1},
+		}
+	}
+
+	for _, tc := range []struct{ temperature, wantA float64 }{
+		{0, 0.75},
+		{1, 0.75},
+		{2, math.Sqrt(3) / (math.Sqrt(3) + 1)},
+	} {
+		m, err := NewMixture(sources(), tc.temperature)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p := m.Probabilities(); math.Abs(p[0]-tc.wantA) > 1e-9 {
+			t.Errorf("temperature %g: probabilities %v, want %g for a", tc.temperature, p, tc.wantA)
+		}
+		m.Rand = rand.New(rand.NewSource(1))
+		x, y := m.GetBatch(4000)
+		drawn := 0
+		for b := 0; b < 4000; b++ {
+			if x.Data[b*4] == 0 {
+				drawn++
+				if y[b*4+3] != 0 {
+					t.Fatalf("window mixes sources: %v", y[b*4:b*4+4])
+				}
+			}
+		}
+		if frac := float64(drawn) / 4000; math.Abs(frac-tc.wantA) > 0.03 {
+			t.Errorf("temperature %g: drew %.3f from a, want %.3f", tc.temperature, frac, tc.wantA)
+		}
+		if tokens := m.Tokens(); tokens[0] != int64(4*drawn) || tokens[1] != int64(4*(4000-drawn)) {
+			t.Errorf("token counts %v for %d windows from a", tokens, drawn)
+		}
+	}
+
+	// A restored mixture continues exactly
+	m, _ := NewMixture(sources(), 1)
+	m.Rand = rand.New(rand.NewSource(5))
+	m.GetBatch(37)
+	resumed, _ := NewMixture(sources(), 1)
+	if err := resumed.SetState(m.State()); err != nil {
+		t.Fatal(err)
+	}
+	resumed.Rand = rand.New(rand.NewSource(9))
+	m.Rand = rand.New(rand.NewSource(9))
+	want, _ := m.GetBatch(20)
+	got, _ := resumed.GetBatch(20)
+	if !reflect.DeepEqual(want.Data, got.Data) || !reflect.DeepEqual(m.Tokens(), resumed.Tokens()) {
+		t.Error("restored mixture diverged")
+	}
+
+	// Rows are redrawn from the others when a source has no window
+	m, _ = NewMixture([]MixtureSource{
+		{Name: "a", Data: NewIterator(NewTextDataset(constant(2, 200), 4), 4, 1), Weight: 1},
+		{Name: "tiny", Data: NewIterator(NewTextDataset(constant(1, 3), 4), 4, 2), Weight: 1},
+	}, 1)
+	m.Rand = rand.New(rand.NewSource(1))
+	x, _ := m.GetBatch(50)
+	for i, id := range x.Data {
+		if id != 2 {
+			t.Fatalf("row %d drawn from the empty source: %v", i/4, x.Data[i/4*4:i/4*4+4])
+		}
+	}
+	if tokens := m.Tokens(); tokens[0] != 200 || tokens[1] != 0 {
+		t.Errorf("token counts %v, want 200 from a and none from the empty source", tokens)
+	}
+
+	// With every source empty the batch comes back short instead of looping
+	var empty []MixtureSource
+	for i, w := range []float64{0.1, 0.2, 0.7} {
+		empty = append(empty, MixtureSource{Name: "e", Data: NewTextDataset(constant(i, 2), 8), Weight: w})
+	}
+	m, _ = NewMixture(empty, 1)
+	m.Rand = rand.New(rand.NewSource(1))
+	done := make(chan batchPlan)
+	go func() { done <- m.plan(4) }()
+	select {
+	case plan := <-done:
+		if len(plan.rows) != 0 {
+			t.Errorf("empty sources gave %d rows", len(plan.rows))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("planning a batch of empty sources did not return")
+	}
+
+	if _, err := NewMixture([]MixtureSource{{Name: "z", Data: m, Weight: 0}}, 1); err == nil {
+		t.Error("NewMixture accepted a zero weight")
+	}
+}
@@ -0,0 +1,259 @@
+package data
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/brucetruth/minigpt/llm/tensor"
+	"github.com/brucetruth/minigpt/llm/tokenizer"
+)
+
+// SFTRecord is one line of a JSONL instruction dataset: either
+//
+//	{"prompt": "...", "response": "..."}
+//
+// or a conversation
+//
+//	{"messages": [{"role": "user", "content": "..."}, {"role": "assistant", "content": "..."}]}
+type SFTRecord struct {
+	Prompt   string       `json:"prompt,omitempty"`
+	Response string       `json:"response,omitempty"`
+	Messages []SFTMessage `json:"messages,omitempty"`
+}
+
+// SFTMessage is one turn of a conversation record.
+type SFTMessage struct {
+	Role    string `json:"role"` // system, user or assistant
+	Content string `json:"content"`
+}
+
+// ReadSFT reads a JSONL instruction dataset (optionally gzipped). Blank
+// lines are skipped.
+func ReadSFT(path string) ([]SFTRecord, error) {
+	rc, err := OpenDocument(path)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var records []SFTRecord
+	sc := bufio.NewScanner(rc)
+	sc.Buffer(nil, 64<<20)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" {
+			continue
+		}
+		var rec SFTRecord
+		if err := json.Unmarshal([]byte(text), &rec); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if err := rec.validate(); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		records = append(records, rec)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return records, nil
+}
+
+func (rec SFTRecord) validate() error {
+	if len(rec.Messages) == 0 {
+		if rec.Response == "" {
+			return fmt.Errorf("record needs a response or messages")
+		}
+		return nil
+	}
+	if rec.Prompt != "" || rec.Response != "" {
+		return fmt.Errorf("record has both prompt/response and messages")
+	}
+	hasAssistant := false
+	for _, m := range rec.Messages {
+		switch m.Role {
+		case "assistant":
+			hasAssistant = true
+		case "system", "user":
+		default:
+			return fmt.Errorf("unknown message role %q", m.Role)
+		}
+	}
+	if !hasAssistant {
+		return fmt.Errorf("conversation has no assistant message")
+	}
+	return nil
+}
+
+// ChatTemplate renders conversations as text: each message is its role's
+// prefix, the content and Suffix. Template text is encoded with special
+// tokens allowed, so prefixes like "<|user|>" can be registered specials;
+// message content never produces special tokens.
+type ChatTemplate struct {
+	Roles  map[string]string // Role -> text before its messages
+	Suffix string            // After every message
+}
+
+// DefaultChatTemplate works with any tokenizer.
+var DefaultChatTemplate = ChatTemplate{
+	Roles:  map[string]string{"system": "System: ", "user": "User: ", "assistant": "Assistant: "},
+	Suffix: "\n",
+}
+
+// SFTExample is an encoded record. Train[i] reports whether Tokens[i] is a
+// target the model learns: the response, or the content and suffix of
+// assistant messages, and the final <|endoftext|> if the tokenizer has it.
+type SFTExample struct {
+	Tokens []int
+	Train  []bool
+}
+
+// EncodeSFT encodes a record. A prompt/response record is rendered as a
+// user message followed by an assistant message, so both forms train the
+// same format.
+func EncodeSFT(tok tokenizer.Tokenizer, rec SFTRecord, tmpl ChatTemplate) SFTExample {
+	var ex SFTExample
+	add := func(ids []int, train bool) {
+		ex.Tokens = append(ex.Tokens, ids...)
+		for range ids {
+			ex.Train = append(ex.Train, train)
+		}
+	}
+	addTemplate := func(text string, train bool) {
+		ids, _ := tok.EncodeWithPolicy(text, tokenizer.SpecialPolicy{AllowAll: true}) // Only Deny fails
+		add(ids, train)
+	}
+
+	messages := rec.Messages
+	if len(messages) == 0 {
+		if rec.Prompt != "" {
+			messages = append(messages, SFTMessage{Role: "user", Content: rec.Prompt})
+		}
+		messages = append(messages, SFTMessage{Role: "assistant", Content: rec.Response})
+	}
+	for _, m := range messages {
+		assistant := m.Role == "assistant"
+		addTemplate(tmpl.Roles[m.Role], false)
+		add(tok.Encode(m.Content), assistant)
+		addTemplate(tmpl.Suffix, assistant)
+	}
+	if eot, ok := tok.SpecialID(tokenizer.EndOfText); ok {
+		add([]int{eot}, true)
+	}
+	return ex
+}
+
+// SFTDataset yields padded batches of whole examples, one per row, with a
+// loss mask selecting the trained targets. Every example is used once per
+// epoch, in an order shuffled like Iterator's.
+type SFTDataset struct {
+	Examples  []SFTExample
+	BlockSize int
+	Pad       int // Token id filling rows after short examples
+	Seed      int64
+
+	Skipped int // Examples dropped by NewSFTDataset for having no target in the block
+
+	state IteratorState
+	order []int
+}
+
+// NewSFTDataset returns a dataset at the start of epoch 0. Examples longer
+// than BlockSize+1 tokens are truncated; examples left with no trained
+// target are dropped.
+func NewSFTDataset(examples []SFTExample, blockSize, pad int, seed int64) *SFTDataset {
+	ds := &SFTDataset{BlockSize: blockSize, Pad: pad, Seed: seed}
+	for _, ex := range examples {
+		n := min(len(ex.Tokens), blockSize+1)
+		trained := false
+		for _, t := range ex.Train[min(1, n):n] {
+			trained = trained || t
+		}
+		if !trained {
+			ds.Skipped++
+			continue
+		}
+		ds.Examples = append(ds.Examples, SFTExample{Tokens: ex.Tokens[:n], Train: ex.Train[:n]})
+	}
+	ds.shuffle()
+	return ds
+}
+
+// Len is the number of examples.
+func (ds *SFTDataset) Len() int {
+	return len(ds.Examples)
+}
+
+// State returns the current position.
+func (ds *SFTDataset) State() IteratorState {
+	return ds.state
+}
+
+// SetState moves to a position previously returned by State.
+func (ds *SFTDataset) SetState(st IteratorState) {
+	ds.state = st
+	ds.shuffle()
+}
+
+func (ds *SFTDataset) shuffle() {
+	ds.order = ds.order[:0]
+	for i := range ds.Examples {
+		ds.order = append(ds.order, i)
+	}
+	rng := rand.New(tensor.NewRNGSource(ds.Seed + int64(ds.state.Epoch)))
+	rng.Shuffle(len(ds.order), func(i, j int) {
+		ds.order[i], ds.order[j] = ds.order[j], ds.order[i]
+	})
+}
+
+// GetMaskedBatch returns the next batchSize examples as x [B, T] and the
+// targets y, with mask[i] 1 where y[i] is trained on and 0 for prompts and
+// padding.
+func (ds *SFTDataset) GetMaskedBatch(batchSize int) (*tensor.NDArray, []int, []float32) {
+	examples := make([]SFTExample, batchSize)
+	if len(ds.order) == 0 {
+		return ds.MaskedBatch(examples) // Empty
+	}
+	for b := range examples {
+		if ds.state.Pos == len(ds.order) {
+			ds.state = IteratorState{Epoch: ds.state.Epoch + 1}
+			ds.shuffle()
+		}
+		examples[b] = ds.Examples[ds.order[ds.state.Pos]]
+		ds.state.Pos++
+	}
+	return ds.MaskedBatch(examples)
+}
+
+// MaskedBatch returns examples, one row each in the given order, padded and
+// masked like GetMaskedBatch. The position in the epoch does not change, so
+// it suits fixed batches such as validation.
+func (ds *SFTDataset) MaskedBatch(examples []SFTExample) (*tensor.NDArray, []int, []float32) {
+	T := ds.BlockSize
+	x := tensor.New(len(examples), T)
+	y := make([]int, len(examples)*T)
+	mask := make([]float32, len(examples)*T)
+	for i := range y {
+		x.Data[i] = float32(ds.Pad)
+		y[i] = ds.Pad
+	}
+	for b, ex := range examples {
+		for t := 0; t+1 < len(ex.Tokens); t++ {
+			x.Data[b*T+t] = float32(ex.Tokens[t])
+			y[b*T+t] = ex.Tokens[t+1]
+			if ex.Train[t+1] {
+				mask[b*T+t] = 1
+			}
+		}
+	}
+	return x, y, mask
+}
+
+// GetBatch is GetMaskedBatch without the mask.
+func (ds *SFTDataset) GetBatch(batchSize int) (*tensor.NDArray, []int) {
+	x, y, _ := ds.GetMaskedBatch(batchSize)
+	return x, y
+}
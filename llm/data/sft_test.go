@@ -0,0 +1,101 @@
+package data
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brucetruth/minigpt/llm/tokenizer"
+)
+
+func TestSFT(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sft.jsonl")
+	lines := []string{
+		`{"prompt": "hi", "response": "hello"}`,
+		``,
+		`{"messages": [{"role": "system", "content": "be brief"}, {"role": "user", "content": "hi"}, {"role": "assistant", "content": "yo"}]}`,
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	records, err := ReadSFT(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || len(records[1].Messages) != 3 {
+		t.Fatalf("read %+v", records)
+	}
+
+	tok := tokenizer.NewChar()
+	tok.AddSpecial(tokenizer.EndOfText)
+	tok.Train("QA: hiello\nyobrfSystemUsersAistan", 100)
+	eot, _ := tok.SpecialID(tokenizer.EndOfText)
+
+	// The trained tokens spell out exactly the responses and the EOT
+	trained := func(ex SFTExample) string {
+		var ids []int
+		for i, id := range ex.Tokens {
+			if ex.Train[i] && id != eot {
+				ids = append(ids, id)
+			}
+		}
+		return tok.Decode(ids)
+	}
+	pr := EncodeSFT(tok, records[0], DefaultChatTemplate)
+	chat := EncodeSFT(tok, records[1], DefaultChatTemplate)
+	if got := trained(pr); got != "hello\n" {
+		t.Errorf("prompt/response trains on %q", got)
+	}
+	if got := tok.Decode(pr.Tokens); got != "User: hi\nAssistant: hello\n"+tokenizer.EndOfText {
+		t.Errorf("prompt/response rendered as %q", got)
+	}
+	if got := trained(chat); got != "yo\n" {
+		t.Errorf("conversation trains on %q", got)
+	}
+	if got := tok.Decode(chat.Tokens); got != "System: be brief\nUser: hi\nAssistant: yo\n"+tokenizer.EndOfText {
+		t.Errorf("conversation rendered as %q", got)
+	}
+
+	// Block 8 truncates both examples to their prompts, which have nothing
+	// to train on
+	ds := NewSFTDataset([]SFTExample{pr, chat}, 8, eot, 1)
+	if ds.Len() != 0 || ds.Skipped != 2 {
+		t.Errorf("block 8 kept %d examples, skipped %d", ds.Len(), ds.Skipped)
+	}
+	ds = NewSFTDataset([]SFTExample{pr}, 32, eot, 1)
+	x, y, mask := ds.GetMaskedBatch(2)
+	n := len(pr.Tokens) - 1
+	for b := 0; b < 2; b++ {
+		for i := 0; i < 32; i++ {
+			j := b*32 + i
+			if i >= n {
+				if x.Data[j] != float32(eot) || y[j] != eot || mask[j] != 0 {
+					t.Fatalf("padding at %d: x %v y %d mask %v", i, x.Data[j], y[j], mask[j])
+				}
+				continue
+			}
+			if y[j] != pr.Tokens[i+1] || (mask[j] == 1) != pr.Train[i+1] {
+				t.Fatalf("position %d: y %d mask %v", i, y[j], mask[j])
+			}
+		}
+	}
+
+	// Fixed batches leave the epoch position alone
+	st := ds.State()
+	if x, _, _ := ds.MaskedBatch(ds.Examples); x.Shape[0] != 1 || ds.State() != st {
+		t.Errorf("MaskedBatch returned %d rows and moved from %+v to %+v", x.Shape[0], st, ds.State())
+	}
+
+	for _, bad := range []string{
+		`{"prompt": "no response"}`,
+		`{"messages": [{"role": "user", "content": "hi"}]}`,
+		`{"messages": [{"role": "robot", "content": "hi"}, {"role": "assistant", "content": "x"}]}`,
+		`not json`,
+	} {
+		os.WriteFile(path, []byte(bad), 0644)
+		if _, err := ReadSFT(path); err == nil {
+			t.Errorf("ReadSFT accepted %s", bad)
+		}
+	}
+}
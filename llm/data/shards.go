@@ -0,0 +1,254 @@
+package data
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/brucetruth/minigpt/llm/tensor"
+)
+
+// IndexFile lists the shards of a prepared dataset directory.
+const IndexFile = "index.json"
+
+// ShardIndex describes a directory of token shards written by ShardWriter.
+// Each shard is a flat file of little-endian uint16 or uint32 token ids; the
+// corpus is the shards concatenated in order.
+type ShardIndex struct {
+	TokenBytes int     // 2 (uint16) or 4 (uint32)
+	VocabSize  int     // Ids are below this
+	Tokens     int64   // Total over all shards
+	Shards     []Shard // In corpus order
+}
+
+// Shard is one file of a ShardIndex.
+type Shard struct {
+	File   string // Relative to the index
+	Tokens int64
+}
+
+// TokenBytesFor is the smallest shard token width that holds every id of a
+// vocabulary of vocabSize tokens.
+func TokenBytesFor(vocabSize int) int {
+	if vocabSize <= 1<<16 {
+		return 2
+	}
+	return 4
+}
+
+// ShardWriter writes a token stream into shards of at most ShardTokens tokens.
+type ShardWriter struct {
+	dir         string
+	shardTokens int64
+	index       ShardIndex
+
+	f   *os.File
+	w   *bufio.Writer
+	cur int64 // Tokens in the open shard
+	buf []byte
+}
+
+// NewShardWriter creates dir (if needed) for a dataset with the given
+// vocabulary size. Close must be called to write the index.
+func NewShardWriter(dir string, vocabSize int, shardTokens int64) (*ShardWriter, error) {
+	if shardTokens <= 0 {
+		return nil, fmt.Errorf("shard size must be positive, got %d", shardTokens)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &ShardWriter{
+		dir:         dir,
+		shardTokens: shardTokens,
+		index:       ShardIndex{TokenBytes: TokenBytesFor(vocabSize), VocabSize: vocabSize},
+	}, nil
+}
+
+// Write appends ids to the dataset.
+func (sw *ShardWriter) Write(ids []int) error {
+	for len(ids) > 0 {
+		if sw.f == nil || sw.cur == sw.shardTokens {
+			if err := sw.nextShard(); err != nil {
+				return err
+			}
+		}
+		n := int(min(int64(len(ids)), sw.shardTokens-sw.cur))
+		if err := sw.writeShard(ids[:n]); err != nil {
+			return err
+		}
+		ids = ids[n:]
+	}
+	return nil
+}
+
+func (sw *ShardWriter) writeShard(ids []int) error {
+	width := sw.index.TokenBytes
+	sw.buf = sw.buf[:0]
+	for _, id := range ids {
+		if id < 0 || id >= sw.index.VocabSize {
+			return fmt.Errorf("token id %d out of range [0, %d)", id, sw.index.VocabSize)
+		}
+		if width == 2 {
+			sw.buf = binary.LittleEndian.AppendUint16(sw.buf, uint16(id))
+		} else {
+			sw.buf = binary.LittleEndian.AppendUint32(sw.buf, uint32(id))
+		}
+	}
+	if _, err := sw.w.Write(sw.buf); err != nil {
+		return err
+	}
+	sw.cur += int64(len(ids))
+	sw.index.Shards[len(sw.index.Shards)-1].Tokens = sw.cur
+	sw.index.Tokens += int64(len(ids))
+	return nil
+}
+
+func (sw *ShardWriter) nextShard() error {
+	if err := sw.closeShard(); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("shard-%05d.bin", len(sw.index.Shards))
+	f, err := os.Create(filepath.Join(sw.dir, name))
+	if err != nil {
+		return err
+	}
+	sw.f, sw.w, sw.cur = f, bufio.NewWriterSize(f, 1<<20), 0
+	sw.index.Shards = append(sw.index.Shards, Shard{File: name})
+	return nil
+}
+
+func (sw *ShardWriter) closeShard() error {
+	if sw.f == nil {
+		return nil
+	}
+	err := sw.w.Flush()
+	if cerr := sw.f.Close(); err == nil {
+		err = cerr
+	}
+	sw.f, sw.w = nil, nil
+	return err
+}
+
+// Index returns the index as written so far.
+func (sw *ShardWriter) Index() ShardIndex {
+	return sw.index
+}
+
+// Close finishes the last shard and writes the index.
+func (sw *ShardWriter) Close() error {
+	if err := sw.closeShard(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(sw.index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(sw.dir, IndexFile), data, 0644)
+}
+
+// ReadShardIndex reads the index of a prepared dataset directory.
+func ReadShardIndex(dir string) (*ShardIndex, error) {
+	data, err := os.ReadFile(filepath.Join(dir, IndexFile))
+	if err != nil {
+		return nil, err
+	}
+	var idx ShardIndex
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Join(dir, IndexFile), err)
+	}
+	if idx.TokenBytes != 2 && idx.TokenBytes != 4 {
+		return nil, fmt.Errorf("%s: unsupported token width %d", dir, idx.TokenBytes)
+	}
+	return &idx, nil
+}
+
+// ShardDataset samples batches from memory-mapped token shards, so the
+// corpus can be much larger than RAM; the OS pages in what is read.
+type ShardDataset struct {
+	Index     ShardIndex
+	BlockSize int
+	Rand      *rand.Rand // Offset source; nil uses the global math/rand source
+
+	shards [][]byte // Mapped shard contents
+	starts []int64  // Corpus offset of each shard's first token
+	unmap  []func() error
+}
+
+// OpenShards maps the shards of a prepared dataset directory. Close
+// releases them.
+func OpenShards(dir string, blockSize int) (*ShardDataset, error) {
+	idx, err := ReadShardIndex(dir)
+	if err != nil {
+		return nil, err
+	}
+	ds := &ShardDataset{Index: *idx, BlockSize: blockSize}
+	var start int64
+	for _, s := range idx.Shards {
+		data, unmap, err := mapFile(filepath.Join(dir, s.File))
+		if err != nil {
+			ds.Close()
+			return nil, err
+		}
+		ds.unmap = append(ds.unmap, unmap)
+		if int64(len(data)) != s.Tokens*int64(idx.TokenBytes) {
+			ds.Close()
+			return nil, fmt.Errorf("%s: %d bytes, index says %d tokens of %d bytes", s.File, len(data), s.Tokens, idx.TokenBytes)
+		}
+		ds.shards = append(ds.shards, data)
+		ds.starts = append(ds.starts, start)
+		start += s.Tokens
+	}
+	return ds, nil
+}
+
+// Len is the number of tokens in the corpus.
+func (ds *ShardDataset) Len() int {
+	return int(ds.Index.Tokens)
+}
+
+// ReadTokens copies the tokens at [offset, offset+len(dst)) into dst; the
+// range may span shards.
+func (ds *ShardDataset) ReadTokens(dst []int, offset int) {
+	// Last shard starting at or before offset
+	s := sort.Search(len(ds.starts), func(i int) bool { return ds.starts[i] > int64(offset) }) - 1
+	pos := int64(offset) - ds.starts[s]
+	width := int64(ds.Index.TokenBytes)
+	for i := range dst {
+		for pos*width >= int64(len(ds.shards[s])) {
+			s, pos = s+1, 0
+		}
+		b := ds.shards[s][pos*width:]
+		if width == 2 {
+			dst[i] = int(binary.LittleEndian.Uint16(b))
+		} else {
+			dst[i] = int(binary.LittleEndian.Uint32(b))
+		}
+		pos++
+	}
+}
+
+// GetBatch returns (x, y) tensors like TextDataset.GetBatch.
+func (ds *ShardDataset) GetBatch(batchSize int) (*tensor.NDArray, []int) {
+	return ds.plan(batchSize).build()
+}
+
+func (ds *ShardDataset) plan(batchSize int) batchPlan {
+	return planRandom(ds, ds.BlockSize, batchSize, ds.Rand)
+}
+
+// Close unmaps the shards.
+func (ds *ShardDataset) Close() error {
+	var err error
+	for _, unmap := range ds.unmap {
+		if e := unmap(); err == nil {
+			err = e
+		}
+	}
+	ds.shards, ds.unmap = nil, nil
+	return err
+}
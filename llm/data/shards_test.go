@@ -0,0 +1,67 @@
+package data
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestShardsRoundTrip(t *testing.T) {
+	for _, vocab := range []int{1000, 70000} {
+		r := rand.New(rand.NewSource(1))
+		tokens := make([]int, 1000)
+		for i := range tokens {
+			tokens[i] = r.Intn(vocab)
+		}
+
+		// Small shards and uneven writes, so reads cross shard boundaries
+		dir := t.TempDir()
+		sw, err := NewShardWriter(dir, vocab, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < len(tokens); i += 100 {
+			if err := sw.Write(tokens[i:min(i+100, len(tokens))]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := sw.Write([]int{vocab}); err == nil {
+			t.Error("Write accepted an id outside the vocabulary")
+		}
+		if err := sw.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		ds, err := OpenShards(dir, 16)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ds.Len() != len(tokens) || len(ds.Index.Shards) != 16 || ds.Index.TokenBytes != TokenBytesFor(vocab) {
+			t.Fatalf("vocab %d: %d tokens in %d shards of width %d", vocab, ds.Len(), len(ds.Index.Shards), ds.Index.TokenBytes)
+		}
+
+		got := make([]int, 100)
+		for _, off := range []int{0, 60, 63, 64, 500, 900} {
+			ds.ReadTokens(got, off)
+			for i := range got {
+				if got[i] != tokens[off+i] {
+					t.Fatalf("vocab %d: token %d = %d, want %d", vocab, off+i, got[i], tokens[off+i])
+				}
+			}
+		}
+
+		// Same seed, same batches as the in-memory dataset
+		text := NewTextDataset(tokens, 16)
+		text.Rand = rand.New(rand.NewSource(7))
+		ds.Rand = rand.New(rand.NewSource(7))
+		wantX, wantY := text.GetBatch(8)
+		gotX, gotY := ds.GetBatch(8)
+		for i := range wantY {
+			if gotX.Data[i] != wantX.Data[i] || gotY[i] != wantY[i] {
+				t.Fatalf("vocab %d: batch differs at %d", vocab, i)
+			}
+		}
+		if err := ds.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
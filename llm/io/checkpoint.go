@@ -1,23 +1,86 @@
 package io
 
 import (
+	"bufio"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"hash/crc32"
+	stdio "io"
+	"math"
 	"os"
 
 	"github.com/brucetruth/minigpt/llm/nn"
 	"github.com/brucetruth/minigpt/llm/transformer"
 )
 
+// Weights file layout, all integers uint32 little-endian:
+//
+//	Header: Magic "MGPT" | Version | TensorCount
+//	Tensor: NameLen | Name | Rank | Dims... | DataLen | Data (float32 LE) | CRC32(Data)
+//
+// Version 0 files (written before the header existed) have no header and no
+// checksums. They are still readable.
+const (
+	weightsMagic   = "MGPT"
+	weightsVersion = 1
+
+	maxNameLen = 1 << 16
+	maxRank    = 8
+)
+
 type CheckpointMetadata struct {
 	Step   int
 	Loss   float32
 	Config transformer.Config
+
+	// Validation loss at the last evaluation and the lowest seen in the
+	// run; zero if the run did no evaluation.
+	ValLoss     float32 `json:",omitempty"`
+	BestValLoss float32 `json:",omitempty"`
+}
+
+// LoadOptions controls how LoadCheckpointWithOptions treats tensors that do
+// not line up with the model.
+type LoadOptions struct {
+	// Strict turns any missing, unexpected or mis-shaped tensor into an error
+	// and leaves the model untouched. Otherwise such tensors are skipped and
+	// listed in the LoadReport. Corrupt or truncated files always fail.
+	Strict bool
+}
+
+// LoadReport describes what a load did with each tensor.
+type LoadReport struct {
+	Version    int
+	Loaded     []string
+	Missing    []string       // In the model but not in the checkpoint
+	Unexpected []string       // In the checkpoint but not in the model
+	Mismatched []*TensorError // Present in both with different shapes
+}
+
+// OK reports whether every model tensor was restored and nothing was left over.
+func (r *LoadReport) OK() bool {
+	return len(r.Missing) == 0 && len(r.Unexpected) == 0 && len(r.Mismatched) == 0
+}
+
+// Err returns the first problem in the report as a *TensorError, or nil.
+func (r *LoadReport) Err() error {
+	switch {
+	case len(r.Mismatched) > 0:
+		return r.Mismatched[0]
+	case len(r.Missing) > 0:
+		return &TensorError{Name: r.Missing[0], Err: ErrMissingTensor}
+	case len(r.Unexpected) > 0:
+		return &TensorError{Name: r.Unexpected[0], Err: ErrUnexpectedTensor}
+	}
+	return nil
 }
 
 func SaveCheckpoint(path string, model *transformer.GPT, meta CheckpointMetadata) error {
-	os.MkdirAll(path, 0755)
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
 
 	// 1. Save Metadata
 	metaData, err := json.Marshal(meta)
@@ -29,62 +92,91 @@ func SaveCheckpoint(path string, model *transformer.GPT, meta CheckpointMetadata
 	}
 
 	// 2. Save Weights
-	// Format: simple concatenation of all float32 data
-	// Or name -> data mapping?
-	// Prompt: "checkpoint: metadata JSON + weights .bin float32 LE"
-	// We'll just dump all parameters in a defined order or map.
-	// To be safe, let's use a simple binary format:
-	// [NameLen(4)][Name(N)][ShapeLen(4)][Shape(N*4)][DataLen(4)][Data(N*4)]...
-
-	f, err := os.Create(path + "/weights.bin")
+	// Written to a temporary file and renamed, so an interrupted save never
+	// leaves a half-written weights.bin behind.
+	tmpPath := path + "/weights.bin.tmp"
+	f, err := os.Create(tmpPath)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	defer os.Remove(tmpPath) // No-op after a successful rename
 
-	params := model.Parameters()
-	for _, p := range params {
-		if err := writeParam(f, p); err != nil {
+	if err := writeWeights(f, model.NamedParameters()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path+"/weights.bin")
+}
+
+func writeWeights(f *os.File, params []nn.NamedParameter) error {
+	w := bufio.NewWriter(f)
+
+	// Header
+	if _, err := w.WriteString(weightsMagic); err != nil {
+		return err
+	}
+	if err := writeUint32(w, weightsVersion); err != nil {
+		return err
+	}
+	if err := writeUint32(w, len(params)); err != nil {
+		return err
+	}
+
+	// Parameters are stored under their fully qualified names
+	// (e.g. blocks.0.attn.c_attn.weight) so every tensor is unique.
+	for _, np := range params {
+		if err := writeParam(w, np.Name, np.Param); err != nil {
 			return err
 		}
 	}
-	return nil
+	return w.Flush()
 }
 
-func writeParam(f *os.File, p *nn.Parameter) error {
+func writeParam(w *bufio.Writer, name string, p *nn.Parameter) error {
 	// Name
-	nameBytes := []byte(p.Name)
-	if err := binary.Write(f, binary.LittleEndian, int32(len(nameBytes))); err != nil {
+	if err := writeUint32(w, len(name)); err != nil {
 		return err
 	}
-	if _, err := f.Write(nameBytes); err != nil {
+	if _, err := w.WriteString(name); err != nil {
 		return err
 	}
 
 	// Shape
 	shape := p.Data.Shape
-	if err := binary.Write(f, binary.LittleEndian, int32(len(shape))); err != nil {
+	if err := writeUint32(w, len(shape)); err != nil {
 		return err
 	}
 	for _, s := range shape {
-		if err := binary.Write(f, binary.LittleEndian, int32(s)); err != nil {
+		if err := writeUint32(w, s); err != nil {
 			return err
 		}
 	}
 
-	// Data
+	// Data + checksum
 	data := p.Data.Data
-	if err := binary.Write(f, binary.LittleEndian, int32(len(data))); err != nil {
+	if err := writeUint32(w, len(data)); err != nil {
 		return err
 	}
-	if err := binary.Write(f, binary.LittleEndian, data); err != nil {
+	buf := make([]byte, 4*len(data))
+	for i, v := range data {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(v))
+	}
+	if _, err := w.Write(buf); err != nil {
 		return err
 	}
-	return nil
+	return writeUint32(w, int(crc32.ChecksumIEEE(buf)))
 }
 
-func LoadCheckpoint(path string, model *transformer.GPT) (*CheckpointMetadata, error) {
-	// Load Metadata
+func writeUint32(w stdio.Writer, v int) error {
+	return binary.Write(w, binary.LittleEndian, uint32(v))
+}
+
+// ReadMetadata reads only meta.json, e.g. to build a model of the right
+// shape before loading its weights.
+func ReadMetadata(path string) (*CheckpointMetadata, error) {
 	metaData, err := os.ReadFile(path + "/meta.json")
 	if err != nil {
 		return nil, err
@@ -93,76 +185,223 @@ func LoadCheckpoint(path string, model *transformer.GPT) (*CheckpointMetadata, e
 	if err := json.Unmarshal(metaData, &meta); err != nil {
 		return nil, err
 	}
+	return &meta, nil
+}
+
+// LoadCheckpoint strictly restores every model tensor from path.
+// Any missing, unexpected or mis-shaped tensor is an error.
+func LoadCheckpoint(path string, model *transformer.GPT) (*CheckpointMetadata, error) {
+	meta, _, err := LoadCheckpointWithOptions(path, model, LoadOptions{Strict: true})
+	return meta, err
+}
+
+// LoadCheckpointWithOptions restores model weights from path and reports
+// which tensors were loaded, missing, unexpected or mis-shaped.
+func LoadCheckpointWithOptions(path string, model *transformer.GPT, opts LoadOptions) (*CheckpointMetadata, *LoadReport, error) {
+	// Load Metadata
+	meta, err := ReadMetadata(path)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	// Load Weights
 	f, err := os.Open(path + "/weights.bin")
 	if err != nil {
-		return &meta, err
+		return meta, nil, err
 	}
 	defer f.Close()
 
-	// Map existing params by name for easy loading
-	paramMap := make(map[string]*nn.Parameter)
-	for _, p := range model.Parameters() {
-		paramMap[p.Name] = p
+	report, err := readWeights(bufio.NewReader(f), model.NamedParameters(), opts)
+	if err != nil {
+		return meta, report, fmt.Errorf("%s/weights.bin: %w", path, err)
 	}
+	return meta, report, nil
+}
+
+// readWeights decodes a weights file and copies matching tensors into params.
+// Nothing is copied unless the whole file decodes (and, in strict mode,
+// matches the model exactly).
+func readWeights(r *bufio.Reader, params []nn.NamedParameter, opts LoadOptions) (*LoadReport, error) {
+	report := &LoadReport{}
 
-	for {
-		name, _, data, err := readParam(f)
+	// Header. Version 0 files start directly with the first name length.
+	count := -1
+	magic, err := r.Peek(len(weightsMagic))
+	if err != nil {
+		return report, truncated("header", err)
+	}
+	if string(magic) == weightsMagic {
+		r.Discard(len(weightsMagic))
+		version, err := readUint32(r)
 		if err != nil {
-			if err.Error() == "EOF" {
-				break
-			}
-			return nil, err
+			return report, truncated("header", err)
+		}
+		if version != weightsVersion {
+			return report, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
 		}
+		n, err := readUint32(r)
+		if err != nil {
+			return report, truncated("header", err)
+		}
+		report.Version = version
+		count = n
+	}
+
+	// Map existing params by qualified name for easy loading
+	paramMap := make(map[string]*nn.Parameter, len(params))
+	for _, np := range params {
+		paramMap[np.Name] = np.Param
+	}
+
+	type pending struct {
+		param *nn.Parameter
+		data  []float32
+	}
+	var loads []pending
+	seen := make(map[string]bool, len(params))
+
+	for i := 0; count < 0 || i < count; i++ {
+		name, shape, data, err := readParam(r, report.Version > 0)
+		if err == stdio.EOF && count < 0 {
+			break // Version 0: no tensor count, EOF between tensors is the end
+		}
+		if err != nil {
+			return report, err
+		}
+
+		p, ok := paramMap[name]
+		if !ok && report.Version == 0 && i < len(params) {
+			// Version 0 checkpoints written before qualified names used
+			// generic names ("weight", "embedding", ...) in Parameters() order.
+			name, p, ok = params[i].Name, params[i].Param, true
+		}
+		if !ok {
+			report.Unexpected = append(report.Unexpected, name)
+			continue
+		}
+		if !sameShape(p.Data.Shape, shape) {
+			report.Mismatched = append(report.Mismatched, &TensorError{
+				Name: name, Err: ErrShapeMismatch, Want: p.Data.Shape, Got: shape,
+			})
+			continue
+		}
+		seen[name] = true
+		loads = append(loads, pending{param: p, data: data})
+		report.Loaded = append(report.Loaded, name)
+	}
 
-		if p, ok := paramMap[name]; ok {
-			// Verify shape matches?
-			// Copy data
-			if len(p.Data.Data) != len(data) {
-				// Warn or error
-				fmt.Printf("Warning: size mismatch for %s\n", name)
-				continue
-			}
-			copy(p.Data.Data, data)
+	if count >= 0 {
+		if _, err := r.ReadByte(); err != stdio.EOF {
+			return report, fmt.Errorf("%w: trailing data after %d tensors", ErrCorrupt, count)
 		}
 	}
 
-	return &meta, nil
+	for _, np := range params {
+		if !seen[np.Name] {
+			report.Missing = append(report.Missing, np.Name)
+		}
+	}
+
+	if opts.Strict {
+		if err := report.Err(); err != nil {
+			return report, err
+		}
+	}
+
+	for _, l := range loads {
+		copy(l.param.Data.Data, l.data)
+	}
+	return report, nil
 }
 
-func readParam(f *os.File) (string, []int, []float32, error) {
-	var nameLen int32
-	if err := binary.Read(f, binary.LittleEndian, &nameLen); err != nil {
-		return "", nil, nil, err
+// readParam reads one tensor record. It returns io.EOF only if the stream
+// ends cleanly before the record starts.
+func readParam(r *bufio.Reader, withChecksum bool) (string, []int, []float32, error) {
+	nameLen, err := readUint32(r)
+	if err != nil {
+		if err == stdio.EOF {
+			return "", nil, nil, err
+		}
+		return "", nil, nil, truncated("tensor record", err)
+	}
+	if nameLen > maxNameLen {
+		return "", nil, nil, fmt.Errorf("%w: name length %d", ErrCorrupt, nameLen)
 	}
 	nameBytes := make([]byte, nameLen)
-	if _, err := f.Read(nameBytes); err != nil {
-		return "", nil, nil, err
+	if _, err := stdio.ReadFull(r, nameBytes); err != nil {
+		return "", nil, nil, truncated("tensor name", err)
 	}
 	name := string(nameBytes)
 
-	var shapeLen int32
-	if err := binary.Read(f, binary.LittleEndian, &shapeLen); err != nil {
-		return "", nil, nil, err
+	rank, err := readUint32(r)
+	if err != nil {
+		return "", nil, nil, truncated(name, err)
 	}
-	shape := make([]int, shapeLen)
-	for i := 0; i < int(shapeLen); i++ {
-		var s int32
-		if err := binary.Read(f, binary.LittleEndian, &s); err != nil {
-			return "", nil, nil, err
+	if rank > maxRank {
+		return "", nil, nil, &TensorError{Name: name, Err: fmt.Errorf("%w: rank %d", ErrCorrupt, rank)}
+	}
+	shape := make([]int, rank)
+	size := 1
+	for i := range shape {
+		if shape[i], err = readUint32(r); err != nil {
+			return "", nil, nil, truncated(name, err)
 		}
-		shape[i] = int(s)
+		size *= shape[i]
 	}
 
-	var dataLen int32
-	if err := binary.Read(f, binary.LittleEndian, &dataLen); err != nil {
-		return "", nil, nil, err
+	dataLen, err := readUint32(r)
+	if err != nil {
+		return "", nil, nil, truncated(name, err)
 	}
-	data := make([]float32, dataLen)
-	if err := binary.Read(f, binary.LittleEndian, data); err != nil {
-		return "", nil, nil, err
+	if dataLen != size {
+		return "", nil, nil, &TensorError{Name: name, Err: fmt.Errorf("%w: %d values for shape %v", ErrCorrupt, dataLen, shape)}
+	}
+	buf := make([]byte, 4*dataLen)
+	if _, err := stdio.ReadFull(r, buf); err != nil {
+		return "", nil, nil, truncated(name, err)
+	}
+
+	if withChecksum {
+		sum, err := readUint32(r)
+		if err != nil {
+			return "", nil, nil, truncated(name, err)
+		}
+		if uint32(sum) != crc32.ChecksumIEEE(buf) {
+			return "", nil, nil, &TensorError{Name: name, Err: ErrChecksum}
+		}
 	}
 
+	data := make([]float32, dataLen)
+	for i := range data {
+		data[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
 	return name, shape, data, nil
 }
+
+func readUint32(r stdio.Reader) (int, error) {
+	var v uint32
+	if err := binary.Read(r, binary.LittleEndian, &v); err != nil {
+		return 0, err
+	}
+	return int(v), nil
+}
+
+// truncated converts an EOF in the middle of a record into ErrTruncated.
+func truncated(where string, err error) error {
+	if errors.Is(err, stdio.EOF) || errors.Is(err, stdio.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: in %s", ErrTruncated, where)
+	}
+	return err
+}
+
+func sameShape(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
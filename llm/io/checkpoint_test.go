@@ -0,0 +1,109 @@
+package io
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/brucetruth/minigpt/llm/transformer"
+)
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	cfg := transformer.Config{
+		VocabSize: 20,
+		BlockSize: 8,
+		NLayer:    3,
+		NHead:     2,
+		NEmb:      8,
+		PDrop:     0.0,
+	}
+	src := transformer.NewGPT(cfg)
+	dst := transformer.NewGPT(cfg)
+
+	// Names must be unique for a by-name restore to work.
+	seen := make(map[string]bool)
+	for _, np := range src.NamedParameters() {
+		if seen[np.Name] {
+			t.Fatalf("Duplicate parameter name %q", np.Name)
+		}
+		seen[np.Name] = true
+	}
+	if !seen["blocks.2.attn.c_attn.weight"] || !seen["wte.weight"] {
+		t.Fatalf("Missing expected qualified names, got %v", seen)
+	}
+
+	dir := t.TempDir()
+	if err := SaveCheckpoint(dir, src, CheckpointMetadata{Step: 5, Config: cfg}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	meta, err := LoadCheckpoint(dir, dst)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if meta.Step != 5 {
+		t.Errorf("Expected step 5, got %d", meta.Step)
+	}
+
+	want := src.NamedParameters()
+	got := dst.NamedParameters()
+	for i := range want {
+		for j, v := range want[i].Param.Data.Data {
+			if got[i].Param.Data.Data[j] != v {
+				t.Fatalf("%s[%d]: expected %f, got %f", want[i].Name, j, v, got[i].Param.Data.Data[j])
+			}
+		}
+	}
+}
+
+func TestCheckpointStrictErrors(t *testing.T) {
+	cfg := transformer.Config{VocabSize: 20, BlockSize: 8, NLayer: 2, NHead: 2, NEmb: 8}
+	dir := t.TempDir()
+	if err := SaveCheckpoint(dir, transformer.NewGPT(cfg), CheckpointMetadata{Config: cfg}); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// Fewer layers: the extra block in the file is unexpected.
+	small := cfg
+	small.NLayer = 1
+	if _, err := LoadCheckpoint(dir, transformer.NewGPT(small)); !errors.Is(err, ErrUnexpectedTensor) {
+		t.Errorf("Expected ErrUnexpectedTensor, got %v", err)
+	}
+
+	// More layers: block 2 is missing. Non-strict returns a report instead.
+	big := cfg
+	big.NLayer = 3
+	if _, err := LoadCheckpoint(dir, transformer.NewGPT(big)); !errors.Is(err, ErrMissingTensor) {
+		t.Errorf("Expected ErrMissingTensor, got %v", err)
+	}
+	_, report, err := LoadCheckpointWithOptions(dir, transformer.NewGPT(big), LoadOptions{Strict: false})
+	if err != nil || report.OK() || len(report.Missing) != 12 {
+		t.Errorf("Expected non-strict report with 12 missing tensors, got %+v, %v", report, err)
+	}
+
+	// Different width: shapes mismatch.
+	wide := cfg
+	wide.NEmb = 16
+	var te *TensorError
+	if _, err := LoadCheckpoint(dir, transformer.NewGPT(wide)); !errors.Is(err, ErrShapeMismatch) || !errors.As(err, &te) {
+		t.Errorf("Expected ErrShapeMismatch, got %v", err)
+	}
+
+	weights, err := os.ReadFile(dir + "/weights.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flipped data byte: checksum failure.
+	corrupt := append([]byte(nil), weights...)
+	corrupt[len(corrupt)-10] ^= 0xff
+	os.WriteFile(dir+"/weights.bin", corrupt, 0644)
+	if _, err := LoadCheckpoint(dir, transformer.NewGPT(cfg)); !errors.Is(err, ErrChecksum) {
+		t.Errorf("Expected ErrChecksum, got %v", err)
+	}
+
+	// Cut short: truncated.
+	os.WriteFile(dir+"/weights.bin", weights[:len(weights)/2], 0644)
+	if _, err := LoadCheckpoint(dir, transformer.NewGPT(cfg)); !errors.Is(err, ErrTruncated) {
+		t.Errorf("Expected ErrTruncated, got %v", err)
+	}
+}
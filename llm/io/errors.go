@@ -0,0 +1,37 @@
+package io
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors returned (wrapped) by LoadCheckpoint. Use errors.Is to test
+// for a category and errors.As with *TensorError to get the tensor name.
+var (
+	ErrUnsupportedVersion = errors.New("unsupported weights format version")
+	ErrTruncated          = errors.New("weights file is truncated")
+	ErrCorrupt            = errors.New("weights file is corrupt")
+	ErrChecksum           = errors.New("tensor checksum mismatch")
+	ErrMissingTensor      = errors.New("tensor missing from checkpoint")
+	ErrUnexpectedTensor   = errors.New("unexpected tensor in checkpoint")
+	ErrShapeMismatch      = errors.New("tensor shape mismatch")
+)
+
+// TensorError reports a problem with a single named tensor.
+type TensorError struct {
+	Name string
+	Err  error // One of the sentinel errors above
+	Want []int // Model shape (shape mismatches only)
+	Got  []int // Stored shape (shape mismatches only)
+}
+
+func (e *TensorError) Error() string {
+	if errors.Is(e.Err, ErrShapeMismatch) {
+		return fmt.Sprintf("%s: %v: model %v, checkpoint %v", e.Name, e.Err, e.Want, e.Got)
+	}
+	return fmt.Sprintf("%s: %v", e.Name, e.Err)
+}
+
+func (e *TensorError) Unwrap() error {
+	return e.Err
+}
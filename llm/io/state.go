@@ -0,0 +1,132 @@
+package io
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/brucetruth/minigpt/llm/data"
+	"github.com/brucetruth/minigpt/llm/nn"
+	"github.com/brucetruth/minigpt/llm/optim"
+	"github.com/brucetruth/minigpt/llm/tensor"
+	"github.com/brucetruth/minigpt/llm/transformer"
+)
+
+// TrainingState is everything beyond the weights needed to continue a run
+// exactly where it stopped. It is stored next to the checkpoint as
+// train_state.json plus optimizer.bin (AdamW moments, weights format).
+type TrainingState struct {
+	Step      int              // Completed steps; also the LR schedule position
+	RNGState  uint64           // tensor.RNGSource state used for dropout
+	Optimizer optim.AdamWState // Moments go to optimizer.bin
+
+	// tensor.RNGSource state used for random batch sampling and mixing
+	DataRNGState uint64
+
+	// Position of the epoch iterator; nil when batches are sampled at
+	// random from RNGState.
+	Data *data.IteratorState `json:",omitempty"`
+	// Position of a mixture of several sources instead
+	Mixture *data.MixtureState `json:",omitempty"`
+}
+
+// SaveTrainingState writes st into the checkpoint directory path. The
+// optimizer must have been built over model.Parameters().
+func SaveTrainingState(path string, model *transformer.GPT, st *TrainingState) error {
+	if err := os.MkdirAll(path, 0755); err != nil {
+		return err
+	}
+
+	stateData, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+"/train_state.json", stateData, 0644); err != nil {
+		return err
+	}
+
+	moments, err := momentParams(model, &st.Optimizer)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := path + "/optimizer.bin.tmp"
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath) // No-op after a successful rename
+
+	if err := writeWeights(f, moments); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path+"/optimizer.bin")
+}
+
+// LoadTrainingState reads the state saved by SaveTrainingState. The moment
+// tensors must match model exactly.
+func LoadTrainingState(path string, model *transformer.GPT) (*TrainingState, error) {
+	stateData, err := os.ReadFile(path + "/train_state.json")
+	if err != nil {
+		return nil, err
+	}
+	var st TrainingState
+	if err := json.Unmarshal(stateData, &st); err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path + "/optimizer.bin")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	total := 0
+	for _, p := range model.Parameters() {
+		total += p.Data.Size
+	}
+	st.Optimizer.M = make([]float32, total)
+	st.Optimizer.V = make([]float32, total)
+
+	moments, err := momentParams(model, &st.Optimizer)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := readWeights(bufio.NewReader(f), moments, LoadOptions{Strict: true}); err != nil {
+		return nil, fmt.Errorf("%s/optimizer.bin: %w", path, err)
+	}
+	return &st, nil
+}
+
+// momentParams exposes the flattened AdamW moments as per-parameter tensors
+// named m.<param> and v.<param>, sharing memory with s.
+func momentParams(model *transformer.GPT, s *optim.AdamWState) ([]nn.NamedParameter, error) {
+	named := model.NamedParameters()
+	var out []nn.NamedParameter
+	offset := 0
+	for _, np := range named {
+		size := np.Param.Data.Size
+		if offset+size > len(s.M) || offset+size > len(s.V) {
+			return nil, fmt.Errorf("optimizer state smaller than model (%d values)", len(s.M))
+		}
+		out = append(out,
+			nn.NamedParameter{Name: "m." + np.Name, Param: momentParam(s.M[offset:offset+size], np.Param.Data.Shape)},
+			nn.NamedParameter{Name: "v." + np.Name, Param: momentParam(s.V[offset:offset+size], np.Param.Data.Shape)},
+		)
+		offset += size
+	}
+	if offset != len(s.M) || offset != len(s.V) {
+		return nil, fmt.Errorf("optimizer state has %d values, model has %d", len(s.M), offset)
+	}
+	return out, nil
+}
+
+func momentParam(data []float32, shape []int) *nn.Parameter {
+	t := &tensor.NDArray{Data: data, Shape: shape, Size: len(data)}
+	return &nn.Parameter{Data: t}
+}
@@ -17,7 +17,7 @@ func NewEmbedding(vocabSize, embDim int) *Embedding {
 		Weight: &Parameter{
 			Data: tensor.NewRandom(vocabSize, embDim), // Usually normal(0, 1)
 			Grad: tensor.New(vocabSize, embDim),
-			Name: "embedding",
+			Name: "weight",
 		},
 	}
 }
@@ -59,3 +59,8 @@ func (e *Embedding) Backward(gradOutput *tensor.NDArray) {
 func (e *Embedding) Parameters() []*Parameter {
 	return []*Parameter{e.Weight}
 }
+
+// NamedParameters returns the lookup table as prefix.weight.
+func (e *Embedding) NamedParameters(prefix string) []NamedParameter {
+	return []NamedParameter{{Name: JoinName(prefix, "weight"), Param: e.Weight}}
+}
@@ -1,8 +1,9 @@
 package nn
 
 import (
-	"math"
+	"math/rand"
 
+	"github.com/brucetruth/minigpt/llm/backend"
 	"github.com/brucetruth/minigpt/llm/tensor"
 )
 
@@ -20,8 +21,8 @@ type LayerNorm struct {
 
 func NewLayerNorm(dim int) *LayerNorm {
 	ln := &LayerNorm{
-		Gamma: &Parameter{Data: tensor.NewFull(1.0, dim), Grad: tensor.New(dim), Name: "ln_gamma"},
-		Beta:  &Parameter{Data: tensor.NewFull(0.0, dim), Grad: tensor.New(dim), Name: "ln_beta"},
+		Gamma: &Parameter{Data: tensor.NewFull(1.0, dim), Grad: tensor.New(dim), Name: "weight"},
+		Beta:  &Parameter{Data: tensor.NewFull(0.0, dim), Grad: tensor.New(dim), Name: "bias"},
 		Eps:   1e-5,
 	}
 	return ln
@@ -29,44 +30,9 @@ func NewLayerNorm(dim int) *LayerNorm {
 
 func (ln *LayerNorm) Forward(x *tensor.NDArray) *tensor.NDArray {
 	ln.input = x
-	dim := x.Shape[len(x.Shape)-1]
-	batch := x.Size / dim
-	
-	out := tensor.New(x.Shape...)
-	ln.mean = make([]float32, batch)
-	ln.rstd = make([]float32, batch)
-	
-	gamma := ln.Gamma.Data.Data
-	beta := ln.Beta.Data.Data
-	
-	for b := 0; b < batch; b++ {
-		offset := b * dim
-		
-		// Mean
-		var sum float32
-		for i := 0; i < dim; i++ {
-			sum += x.Data[offset+i]
-		}
-		mean := sum / float32(dim)
-		ln.mean[b] = mean
-		
-		// Var
-		var sumSq float32
-		for i := 0; i < dim; i++ {
-			diff := x.Data[offset+i] - mean
-			sumSq += diff * diff
-		}
-		variance := sumSq / float32(dim)
-		rstd := float32(1.0 / math.Sqrt(float64(variance)+float64(ln.Eps)))
-		ln.rstd[b] = rstd
-		
-		// Normalize and Scale
-		for i := 0; i < dim; i++ {
-			normalized := (x.Data[offset+i] - mean) * rstd
-			out.Data[offset+i] = normalized*gamma[i] + beta[i]
-		}
-	}
-	
+	out, mean, rstd := backend.LayerNorm(x, ln.Gamma.Data, ln.Beta.Data, ln.Eps)
+	ln.mean = mean
+	ln.rstd = rstd
 	return out
 }
 
@@ -129,9 +95,20 @@ func (ln *LayerNorm) Parameters() []*Parameter {
 	return []*Parameter{ln.Gamma, ln.Beta}
 }
 
+// NamedParameters returns gamma and beta as prefix.weight and prefix.bias.
+func (ln *LayerNorm) NamedParameters(prefix string) []NamedParameter {
+	return []NamedParameter{
+		{Name: JoinName(prefix, "weight"), Param: ln.Gamma},
+		{Name: JoinName(prefix, "bias"), Param: ln.Beta},
+	}
+}
+
 // Dropout Layer
 type Dropout struct {
 	P    float32
+	Rand *rand.Rand // Mask source; nil uses the global math/rand source
+	Eval bool       // Pass inputs through unchanged, as at inference
+
 	mask *tensor.NDArray
 }
 
@@ -140,19 +117,20 @@ func NewDropout(p float32) *Dropout {
 }
 
 func (d *Dropout) Forward(x *tensor.NDArray) *tensor.NDArray {
-	if d.P == 0 {
+	if d.P == 0 || d.Eval {
+		d.mask = nil
 		return x
 	}
-	out, mask := tensor.Dropout(x, d.P)
+	out, mask := tensor.DropoutWithRand(x, d.P, d.Rand)
 	d.mask = mask
 	return out
 }
 
 func (d *Dropout) Backward(gradOutput *tensor.NDArray) *tensor.NDArray {
-	if d.P == 0 {
+	if d.mask == nil {
 		return gradOutput
 	}
-	return tensor.Mul(gradOutput, d.mask)
+	return backend.Mul(gradOutput, d.mask)
 }
 
 func (d *Dropout) Parameters() []*Parameter {
@@ -41,3 +41,34 @@ func TestSoftmaxStability(t *testing.T) {
 		t.Errorf("Expected %f, got %f", expected, out.Data[1])
 	}
 }
+
+func TestLinearBackwardAccumulates(t *testing.T) {
+	l := NewLinear(5, 3)
+	x := tensor.NewRandom(2, 4, 5)
+	grad := tensor.NewRandom(2, 4, 3)
+
+	// Two backward passes must sum into the gradients.
+	for pass := 0; pass < 2; pass++ {
+		l.Forward(x)
+		l.Backward(grad)
+	}
+
+	for r := 0; r < 3; r++ {
+		var db float32
+		for n := 0; n < 8; n++ {
+			db += grad.Data[n*3+r]
+		}
+		if math.Abs(float64(l.B.Grad.Data[r]-2*db)) > 1e-4 {
+			t.Errorf("dB[%d]: expected %f, got %f", r, 2*db, l.B.Grad.Data[r])
+		}
+		for c := 0; c < 5; c++ {
+			var dw float32
+			for n := 0; n < 8; n++ {
+				dw += grad.Data[n*3+r] * x.Data[n*5+c]
+			}
+			if math.Abs(float64(l.W.Grad.Data[r*5+c]-2*dw)) > 1e-4 {
+				t.Errorf("dW[%d,%d]: expected %f, got %f", r, c, 2*dw, l.W.Grad.Data[r*5+c])
+			}
+		}
+	}
+}
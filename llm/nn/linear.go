@@ -3,6 +3,7 @@ package nn
 import (
 	"fmt"
 
+	"github.com/brucetruth/minigpt/llm/backend"
 	"github.com/brucetruth/minigpt/llm/tensor"
 )
 
@@ -47,8 +48,7 @@ func (l *Linear) Forward(x *tensor.NDArray) *tensor.NDArray {
 	numElements := x.Size / inDim
 	xFlat, _ := x.View(numElements, inDim)
 
-	wt := tensor.Transpose(l.W.Data)
-	outFlat := tensor.MatMul(xFlat, wt) // [N, Out]
+	outFlat := backend.BatchedMatMul(xFlat, l.W.Data, false, true) // [N, In] x [Out, In]^T -> [N, Out]
 
 	// Reshape back
 	outShape := make([]int, rank)
@@ -88,7 +88,7 @@ func (l *Linear) Backward(gradOutput *tensor.NDArray) *tensor.NDArray {
 	numElements := gradOutput.Size / outDim
 	gradFlat, _ := gradOutput.View(numElements, outDim)
 
-	dInputFlat := tensor.MatMul(gradFlat, l.W.Data) // [N, In]
+	dInputFlat := backend.MatMul(gradFlat, l.W.Data) // [N, In]
 
 	// Reshape dInput back
 	inDim := l.W.Data.Shape[1]
@@ -98,38 +98,22 @@ func (l *Linear) Backward(gradOutput *tensor.NDArray) *tensor.NDArray {
 
 	dInput, _ := dInputFlat.View(dInputShape...)
 
-	// 2. dW
-	// We need input^T * gradOutput.
-	// If input is [B, T, In] and grad is [B, T, Out].
-	// Reshape to [B*T, In] and [B*T, Out].
-	// Then (In, B*T) * (B*T, Out) -> (In, Out). Then transpose to (Out, In)?
-	// Or (Out, B*T) * (B*T, In) -> (Out, In).
-	// Let's rely on iterating.
-
-	// Implementing gradient accumulation for W and B
-	// dW: [Out, In]
-
-	batchSize := l.input.Size / l.W.Data.Shape[1] // Total tokens
-	// inDim is already defined
-	outDim = l.W.Data.Shape[0]
-
-	// Accumulate into l.W.Grad
-	for i := 0; i < batchSize; i++ {
-		offsetIn := i * inDim
-		offsetGrad := i * outDim
-
-		for r := 0; r < outDim; r++ {
-			gradVal := gradOutput.Data[offsetGrad+r]
-			for c := 0; c < inDim; c++ {
-				val := gradVal * l.input.Data[offsetIn+c]
-				l.W.Grad.Data[r*inDim+c] += val
-			}
-		}
-
-		// Accumulate bias
-		for r := 0; r < outDim; r++ {
-			l.B.Grad.Data[r] += gradOutput.Data[offsetGrad+r]
-		}
+	// 2. dW = gradOutput^T * input: [Out, N] x [N, In] -> [Out, In]
+	// The TN product reads gradFlat in place, no transpose copy.
+	inFlat, _ := l.input.View(numElements, inDim)
+	dW := backend.BatchedMatMul(gradFlat, inFlat, true, false)
+
+	// 3. dB = ones^T * gradOutput: [1, N] x [N, Out] -> [1, Out]
+	ones := tensor.New(1, numElements)
+	for i := range ones.Data {
+		ones.Data[i] = 1
+	}
+	dB := backend.MatMul(ones, gradFlat)
+
+	// Accumulate, so gradients add up across calls until ZeroGrad
+	tensor.AddInto(l.W.Grad, l.W.Grad, dW)
+	for r, g := range dB.Data {
+		l.B.Grad.Data[r] += g
 	}
 
 	return dInput
@@ -138,3 +122,11 @@ func (l *Linear) Backward(gradOutput *tensor.NDArray) *tensor.NDArray {
 func (l *Linear) Parameters() []*Parameter {
 	return []*Parameter{l.W, l.B}
 }
+
+// NamedParameters returns the parameters as prefix.weight and prefix.bias.
+func (l *Linear) NamedParameters(prefix string) []NamedParameter {
+	return []NamedParameter{
+		{Name: JoinName(prefix, "weight"), Param: l.W},
+		{Name: JoinName(prefix, "bias"), Param: l.B},
+	}
+}
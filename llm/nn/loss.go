@@ -3,65 +3,126 @@ package nn
 import (
 	"math"
 
+	"github.com/brucetruth/minigpt/llm/backend"
 	"github.com/brucetruth/minigpt/llm/tensor"
 )
 
+// IgnoreIndex as a target leaves that position out of the loss, its
+// gradient and the average, e.g. for padding.
+const IgnoreIndex = -100
+
 // CrossEntropyLoss combines LogSoftmax and NLLLoss.
 // Expects logits [B*T, Vocab] and targets [B*T].
 type CrossEntropyLoss struct {
+	// LabelSmoothing ε trains towards 1-ε on the target and ε spread
+	// evenly over the whole vocabulary instead of a one-hot target.
+	// 0 disables it.
+	LabelSmoothing float32
 }
 
 func NewCrossEntropyLoss() *CrossEntropyLoss {
 	return &CrossEntropyLoss{}
 }
 
-// Forward returns scalar loss.
+// Forward returns scalar loss, averaged over the targets that are not
+// IgnoreIndex.
 // logits: [N, C]
 // targets: [N] (indices)
 func (l *CrossEntropyLoss) Forward(logits *tensor.NDArray, targets []int) float32 {
-	// 1. Softmax
-	probs := tensor.Softmax(logits)
-	
-	// 2. NLL: -log(probs[target])
-	var totalLoss float32
-	batchSize := logits.Shape[0]
-	vocabSize := logits.Shape[1]
-	
-	for i := 0; i < batchSize; i++ {
-		targetErr := targets[i]
-		prob := probs.Data[i*vocabSize + targetErr]
-		// Clip for stability
-		if prob < 1e-10 {
-			prob = 1e-10
-		}
-		totalLoss += -float32(math.Log(float64(prob)))
-	}
-	
-	return totalLoss / float32(batchSize)
+	return l.ForwardMasked(logits, targets, nil)
 }
 
 // Backward returns gradients for logits.
 // dL/dz_i = p_i - y_i
 func (l *CrossEntropyLoss) Backward(logits *tensor.NDArray, targets []int) *tensor.NDArray {
-	probs := tensor.Softmax(logits)
-	dLogits := tensor.New(logits.Shape...)
-	
-	batchSize := logits.Shape[0]
+	return l.BackwardMasked(logits, targets, nil)
+}
+
+// ForwardMasked is Forward with a weight per position: mask[i] scales the
+// loss of targets[i], and the result is normalized by the sum of the mask
+// instead of N, so positions with weight 0 (padding, prompts) neither count
+// nor dilute the average. A nil mask weighs every position 1. Targets equal
+// to IgnoreIndex weigh 0 either way.
+func (l *CrossEntropyLoss) ForwardMasked(logits *tensor.NDArray, targets []int, mask []float32) float32 {
+	weights, totalWeight := lossWeights(targets, mask)
+	if totalWeight == 0 {
+		return 0
+	}
 	vocabSize := logits.Shape[1]
-	scale := 1.0 / float32(batchSize)
-	
-	copy(dLogits.Data, probs.Data)
-	
-	for i := 0; i < batchSize; i++ {
-		target := targets[i]
-		idx := i*vocabSize + target
-		dLogits.Data[idx] -= 1.0
+	eps := float64(l.LabelSmoothing)
+
+	var totalLoss float64
+	for i, w := range weights {
+		if w == 0 {
+			continue
+		}
+		row := logits.Data[i*vocabSize : (i+1)*vocabSize]
+
+		// log p_j = z_j - logsumexp(z), computed stably
+		maxZ := math.Inf(-1)
+		for _, z := range row {
+			maxZ = math.Max(maxZ, float64(z))
+		}
+		var sumExp, sumZ float64
+		for _, z := range row {
+			sumExp += math.Exp(float64(z) - maxZ)
+			sumZ += float64(z)
+		}
+		logSumExp := maxZ + math.Log(sumExp)
+
+		// -Σ_j q_j log p_j with q = (1-ε)·onehot + ε/C
+		nll := logSumExp - float64(row[targets[i]])
+		loss := nll
+		if eps != 0 {
+			meanNLL := logSumExp - sumZ/float64(vocabSize)
+			loss = (1-eps)*nll + eps*meanNLL
+		}
+		totalLoss += float64(w) * loss
 	}
-	
-	// Scale by 1/BatchSize
-	for i := range dLogits.Data {
-		dLogits.Data[i] *= scale
+	return float32(totalLoss / float64(totalWeight))
+}
+
+// BackwardMasked returns the gradients of ForwardMasked for logits:
+// (p - q) · mask[i] / Σ mask for each row.
+func (l *CrossEntropyLoss) BackwardMasked(logits *tensor.NDArray, targets []int, mask []float32) *tensor.NDArray {
+	dLogits := tensor.New(logits.Shape...)
+	weights, totalWeight := lossWeights(targets, mask)
+	if totalWeight == 0 {
+		return dLogits
+	}
+	probs := backend.Softmax(logits)
+	vocabSize := logits.Shape[1]
+	eps := l.LabelSmoothing
+
+	for i, w := range weights {
+		if w == 0 {
+			continue
+		}
+		scale := w / totalWeight
+		row := dLogits.Data[i*vocabSize : (i+1)*vocabSize]
+		for j, p := range probs.Data[i*vocabSize : (i+1)*vocabSize] {
+			row[j] = (p - eps/float32(vocabSize)) * scale
+		}
+		row[targets[i]] -= (1 - eps) * scale
 	}
-	
 	return dLogits
 }
+
+// lossWeights returns the weight of each position (mask, or 1, and 0 for
+// IgnoreIndex targets) and their sum.
+func lossWeights(targets []int, mask []float32) ([]float32, float32) {
+	weights := make([]float32, len(targets))
+	var total float32
+	for i, target := range targets {
+		w := float32(1)
+		if mask != nil {
+			w = mask[i]
+		}
+		if target == IgnoreIndex {
+			w = 0
+		}
+		weights[i] = w
+		total += w
+	}
+	return weights, total
+}
@@ -0,0 +1,136 @@
+package nn
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/brucetruth/minigpt/llm/tensor"
+)
+
+func TestCrossEntropyMasked(t *testing.T) {
+	logits := tensor.NewFromData([]float32{
+		1, 2, 0.5,
+		0.1, -1, 3,
+		2, 2, -2,
+	}, 3, 3)
+	targets := []int{1, 2, 0}
+	ce := NewCrossEntropyLoss()
+
+	// An all-ones mask is plain cross entropy
+	ones := []float32{1, 1, 1}
+	if got, want := ce.ForwardMasked(logits, targets, ones), ce.Forward(logits, targets); math.Abs(float64(got-want)) > 1e-6 {
+		t.Errorf("all-ones mask: loss %f, want %f", got, want)
+	}
+	full := ce.Backward(logits, targets)
+	for i, g := range ce.BackwardMasked(logits, targets, ones).Data {
+		if math.Abs(float64(g-full.Data[i])) > 1e-6 {
+			t.Fatalf("all-ones mask: gradient %d is %f, want %f", i, g, full.Data[i])
+		}
+	}
+
+	// Masking the middle row is the loss of the other two alone
+	mask := []float32{1, 0, 1}
+	rest := tensor.NewFromData(append(append([]float32{}, logits.Data[:3]...), logits.Data[6:]...), 2, 3)
+	restTargets := []int{1, 0}
+	if got, want := ce.ForwardMasked(logits, targets, mask), ce.Forward(rest, restTargets); math.Abs(float64(got-want)) > 1e-6 {
+		t.Errorf("masked row: loss %f, want %f", got, want)
+	}
+	grad := ce.BackwardMasked(logits, targets, mask)
+	restGrad := ce.Backward(rest, restTargets)
+	for i, g := range grad.Data {
+		want := float32(0)
+		switch {
+		case i < 3:
+			want = restGrad.Data[i]
+		case i >= 6:
+			want = restGrad.Data[i-3]
+		}
+		if math.Abs(float64(g-want)) > 1e-6 {
+			t.Fatalf("masked row: gradient %d is %f, want %f", i, g, want)
+		}
+	}
+}
+
+func TestCrossEntropyGradients(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	const n, c = 6, 5
+	logits := tensor.New(n, c)
+	for i := range logits.Data {
+		logits.Data[i] = float32(r.NormFloat64() * 2)
+	}
+	targets := []int{0, 3, IgnoreIndex, 4, 1, 2}
+	mask := []float32{1, 0.5, 1, 0, 2, 1}
+
+	for _, tc := range []struct {
+		name      string
+		smoothing float32
+		mask      []float32
+	}{
+		{"plain", 0, nil},
+		{"masked", 0, mask},
+		{"smoothed", 0.1, nil},
+		{"masked and smoothed", 0.2, mask},
+	} {
+		ce := &CrossEntropyLoss{LabelSmoothing: tc.smoothing}
+		grad := ce.BackwardMasked(logits, targets, tc.mask)
+
+		const h = 1e-2
+		for i := range logits.Data {
+			orig := logits.Data[i]
+			logits.Data[i] = orig + h
+			plus := ce.ForwardMasked(logits, targets, tc.mask)
+			logits.Data[i] = orig - h
+			minus := ce.ForwardMasked(logits, targets, tc.mask)
+			logits.Data[i] = orig
+
+			numeric := (plus - minus) / (2 * h)
+			if math.Abs(float64(numeric-grad.Data[i])) > 1e-3 {
+				t.Errorf("%s: gradient %d is %f, finite difference %f", tc.name, i, grad.Data[i], numeric)
+			}
+		}
+
+		// Ignored rows get no gradient
+		for j := 0; j < c; j++ {
+			if grad.Data[2*c+j] != 0 {
+				t.Errorf("%s: ignored row has gradient %v", tc.name, grad.Data[2*c:3*c])
+				break
+			}
+		}
+	}
+}
+
+func TestCrossEntropyIgnoreAndSmoothing(t *testing.T) {
+	logits := tensor.NewFromData([]float32{
+		2, 0, -1,
+		0.5, 0.5, 3,
+		1, 1, 1,
+	}, 3, 3)
+	ce := NewCrossEntropyLoss()
+
+	// Ignoring a row averages over the rest only
+	rest := tensor.NewFromData(logits.Data[:6], 2, 3)
+	if got, want := ce.Forward(logits, []int{0, 2, IgnoreIndex}), ce.Forward(rest, []int{0, 2}); math.Abs(float64(got-want)) > 1e-6 {
+		t.Errorf("ignored row: loss %f, want %f", got, want)
+	}
+	if got := ce.Forward(logits, []int{IgnoreIndex, IgnoreIndex, IgnoreIndex}); got != 0 {
+		t.Errorf("all targets ignored: loss %f", got)
+	}
+
+	// Uniform logits give log C whatever the smoothing
+	uniform := tensor.NewFromData([]float32{1, 1, 1}, 1, 3)
+	for _, eps := range []float32{0, 0.1, 1} {
+		ce := &CrossEntropyLoss{LabelSmoothing: eps}
+		if got := ce.Forward(uniform, []int{1}); math.Abs(float64(got)-math.Log(3)) > 1e-6 {
+			t.Errorf("smoothing %g: uniform loss %f, want log 3", eps, got)
+		}
+	}
+
+	// Smoothing penalizes a confident correct prediction
+	confident := tensor.NewFromData([]float32{10, 0, 0}, 1, 3)
+	plain := ce.Forward(confident, []int{0})
+	smoothed := (&CrossEntropyLoss{LabelSmoothing: 0.1}).Forward(confident, []int{0})
+	if !(smoothed > plain) {
+		t.Errorf("smoothed loss %f not above plain %f for a confident prediction", smoothed, plain)
+	}
+}
@@ -1,6 +1,7 @@
 package nn
 
 import (
+	"github.com/brucetruth/minigpt/llm/backend"
 	"github.com/brucetruth/minigpt/llm/tensor"
 )
 
@@ -32,8 +33,9 @@ func (m *MLP) Forward(x *tensor.NDArray) *tensor.NDArray {
 	// Linear 1
 	m.fc1Out = m.FC1.Forward(x)
 
-	// GELU activation
-	m.geluOut, m.geluCache = tensor.GELUWithCache(m.fc1Out)
+	// GELU activation. Its input is all the backward pass needs.
+	m.geluOut = backend.GELU(m.fc1Out)
+	m.geluCache = m.fc1Out
 
 	// Linear 2
 	fc2Out := m.FC2.Forward(m.geluOut)
@@ -52,7 +54,7 @@ func (m *MLP) Backward(gradOutput *tensor.NDArray) *tensor.NDArray {
 	dGELU := m.FC2.Backward(dFC2)
 
 	// Backward through GELU
-	dFC1 := tensor.GELUBackward(dGELU, m.geluCache)
+	dFC1 := backend.GELUBackward(dGELU, m.geluCache)
 
 	// Backward through FC1
 	dInput := m.FC1.Backward(dFC1)
@@ -65,3 +67,10 @@ func (m *MLP) Parameters() []*Parameter {
 	params = append(params, m.FC2.Parameters()...)
 	return params
 }
+
+// NamedParameters uses the GPT-2 names c_fc and c_proj for FC1 and FC2.
+func (m *MLP) NamedParameters(prefix string) []NamedParameter {
+	params := m.FC1.NamedParameters(JoinName(prefix, "c_fc"))
+	params = append(params, m.FC2.NamedParameters(JoinName(prefix, "c_proj"))...)
+	return params
+}
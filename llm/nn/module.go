@@ -20,6 +20,21 @@ func NewParameter(name string, shape ...int) *Parameter {
 	}
 }
 
+// NamedParameter pairs a parameter with its fully qualified name,
+// e.g. "blocks.3.attn.c_attn.weight".
+type NamedParameter struct {
+	Name  string
+	Param *Parameter
+}
+
+// JoinName appends name to a dotted module path.
+func JoinName(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
 // ZeroGrad zeroes out the gradient.
 func (p *Parameter) ZeroGrad() {
 	p.Grad = tensor.NewFull(0.0, p.Data.Shape...)
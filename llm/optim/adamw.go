@@ -1,6 +1,7 @@
 package optim
 
 import (
+	"fmt"
 	"math"
 
 	"github.com/brucetruth/minigpt/llm/nn"
@@ -74,6 +75,38 @@ func (opt *AdamW) Step() {
 	}
 }
 
+// AdamWState is the optimizer state needed to resume training exactly.
+// M and V are flattened in Params order. They are too large for JSON and
+// are left out of it; llm/io stores them in binary form.
+type AdamWState struct {
+	Step int
+	M    []float32 `json:"-"`
+	V    []float32 `json:"-"`
+}
+
+// State returns a copy of the step counter and moment estimates.
+func (opt *AdamW) State() AdamWState {
+	s := AdamWState{
+		Step: opt.step,
+		M:    make([]float32, len(opt.m)),
+		V:    make([]float32, len(opt.v)),
+	}
+	copy(s.M, opt.m)
+	copy(s.V, opt.v)
+	return s
+}
+
+// LoadState restores state previously returned by State.
+func (opt *AdamW) LoadState(s AdamWState) error {
+	if len(s.M) != len(opt.m) || len(s.V) != len(opt.v) {
+		return fmt.Errorf("optimizer state has %d/%d moments, expected %d", len(s.M), len(s.V), len(opt.m))
+	}
+	opt.step = s.Step
+	copy(opt.m, s.M)
+	copy(opt.v, s.V)
+	return nil
+}
+
 func (opt *AdamW) ZeroGrad() {
 	for _, p := range opt.Params {
 		p.ZeroGrad()
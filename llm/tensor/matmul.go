@@ -0,0 +1,246 @@
+package tensor
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// MatMulWorkers is the number of goroutines PureGoMatMul may use.
+// 0 means runtime.GOMAXPROCS(0).
+var MatMulWorkers = 0
+
+// Tiling parameters. A tileK x tileN panel of B (64 KiB) stays in L2 while a
+// block of rows of A streams over it.
+const (
+	tileK = 128
+	tileN = 128
+	tileM = 16 // Rows per parallel task
+
+	// Rows of B kept hot by the NT kernel while rows of A stream over them.
+	tileNT = 64
+
+	// Products smaller than this many multiply-adds run on the calling
+	// goroutine; spawning workers would cost more than it saves.
+	parallelThreshold = 1 << 16
+)
+
+// PureGoMatMul performs generic matrix multiplication in pure Go.
+// Supports broadcasting for last two dims if rank > 2 (batch matmul).
+//
+// The kernel is cache-blocked and splits (batch, row block) tasks across
+// MatMulWorkers goroutines. Every output element is accumulated over the
+// inner dimension in ascending order by exactly one goroutine, so results are
+// the same bits whatever the worker count.
+func PureGoMatMul(a, b *NDArray) *NDArray {
+	return ParallelMatMul(a, b, MatMulWorkers)
+}
+
+// ParallelMatMul is PureGoMatMul with an explicit worker count
+// (0 means runtime.GOMAXPROCS(0)).
+func ParallelMatMul(a, b *NDArray, workers int) *NDArray {
+	return BatchedMatMul(a, b, false, false, workers)
+}
+
+// MatMulNT computes a x b^T without materializing the transpose.
+// a: [..., M, K], b: [..., N, K] -> [..., M, N]
+func MatMulNT(a, b *NDArray) *NDArray {
+	return BatchedMatMul(a, b, false, true, MatMulWorkers)
+}
+
+// MatMulTN computes a^T x b without materializing the transpose.
+// a: [..., K, M], b: [..., K, N] -> [..., M, N]
+func MatMulTN(a, b *NDArray) *NDArray {
+	return BatchedMatMul(a, b, true, false, MatMulWorkers)
+}
+
+// BatchedMatMul computes op(a) x op(b), where op swaps the last two dims of
+// an operand when its trans flag is set. The NT and TN cases read the
+// operands in their stored layout; only TT copies (a is transposed first).
+// Uses workers goroutines (0 means runtime.GOMAXPROCS(0)).
+func BatchedMatMul(a, b *NDArray, transA, transB bool, workers int) *NDArray {
+	if transA && transB {
+		a = Transpose(a)
+		transA = false
+	}
+
+	rank := len(a.Shape)
+	if rank < 2 {
+		panic("matmul requires rank >= 2")
+	}
+
+	// Logical A is [..., M, K], logical B is [..., K, N]
+	m, k := a.Shape[rank-2], a.Shape[rank-1]
+	if transA {
+		m, k = k, m
+	}
+	kb, n := b.Shape[rank-2], b.Shape[rank-1]
+	if transB {
+		kb, n = n, kb
+	}
+	if kb != k {
+		panic("matmul shape mismatch inner dim")
+	}
+
+	// Output shape
+	outShape := make([]int, rank)
+	copy(outShape, a.Shape)
+	outShape[rank-2] = m
+	outShape[rank-1] = n
+
+	out := New(outShape...)
+
+	batch := 1
+	for i := 0; i < rank-2; i++ {
+		batch *= a.Shape[i]
+	}
+
+	strideA := m * k
+	strideB := k * n
+	strideC := m * n
+
+	rowBlocks := (m + tileM - 1) / tileM
+	tasks := batch * rowBlocks
+
+	run := func(task int) {
+		bIdx, blk := task/rowBlocks, task%rowBlocks
+		i0 := blk * tileM
+		i1 := min(i0+tileM, m)
+		sa := a.Data[bIdx*strideA : (bIdx+1)*strideA]
+		sb := b.Data[bIdx*strideB : (bIdx+1)*strideB]
+		sc := out.Data[bIdx*strideC : (bIdx+1)*strideC]
+		switch {
+		case transB:
+			matmulRowsNT(sa, sb, sc, k, n, i0, i1)
+		case transA:
+			matmulRows(sa, sb, sc, 1, m, k, n, i0, i1) // a[i, l] is at l*m + i
+		default:
+			matmulRows(sa, sb, sc, k, 1, k, n, i0, i1) // a[i, l] is at i*k + l
+		}
+	}
+
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, tasks)
+
+	if workers <= 1 || batch*m*n*k < parallelThreshold {
+		for t := 0; t < tasks; t++ {
+			run(t)
+		}
+		return out
+	}
+
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for {
+				t := int(next.Add(1) - 1)
+				if t >= tasks {
+					return
+				}
+				run(t)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return out
+}
+
+// matmulRows computes rows i0..i1-1 of c = A * b for a single matrix, where
+// A[i, l] = a[i*ars + l*acs], b: [K, N], c: [M, N] (c must be zeroed).
+func matmulRows(a, b, c []float32, ars, acs, k, n, i0, i1 int) {
+	for kk := 0; kk < k; kk += tileK {
+		kEnd := min(kk+tileK, k)
+		for jj := 0; jj < n; jj += tileN {
+			jEnd := min(jj+tileN, n)
+
+			// Four rows of A share each loaded row of B.
+			i := i0
+			for ; i+4 <= i1; i += 4 {
+				c0 := c[i*n+jj : i*n+jEnd]
+				c1 := c[(i+1)*n+jj : (i+1)*n+jEnd]
+				c2 := c[(i+2)*n+jj : (i+2)*n+jEnd]
+				c3 := c[(i+3)*n+jj : (i+3)*n+jEnd]
+				for l := kk; l < kEnd; l++ {
+					a0 := a[i*ars+l*acs]
+					a1 := a[(i+1)*ars+l*acs]
+					a2 := a[(i+2)*ars+l*acs]
+					a3 := a[(i+3)*ars+l*acs]
+					bRow := b[l*n+jj : l*n+jEnd]
+					bRow = bRow[:len(c0)]
+					c1 = c1[:len(c0)]
+					c2 = c2[:len(c0)]
+					c3 = c3[:len(c0)]
+					for j, bv := range bRow {
+						c0[j] += a0 * bv
+						c1[j] += a1 * bv
+						c2[j] += a2 * bv
+						c3[j] += a3 * bv
+					}
+				}
+			}
+			for ; i < i1; i++ {
+				cRow := c[i*n+jj : i*n+jEnd]
+				for l := kk; l < kEnd; l++ {
+					av := a[i*ars+l*acs]
+					bRow := b[l*n+jj : l*n+jEnd]
+					bRow = bRow[:len(cRow)]
+					for j, bv := range bRow {
+						cRow[j] += av * bv
+					}
+				}
+			}
+		}
+	}
+}
+
+// matmulRowsNT computes rows i0..i1-1 of c = a * b^T for a single matrix,
+// a: [M, K], b: [N, K], c: [M, N]. Each output is a dot product of two
+// contiguous rows, accumulated in ascending order like matmulRows.
+func matmulRowsNT(a, b, c []float32, k, n, i0, i1 int) {
+	for jj := 0; jj < n; jj += tileNT {
+		jEnd := min(jj+tileNT, n)
+		for i := i0; i < i1; i++ {
+			aRow := a[i*k : i*k+k]
+			cRow := c[i*n : i*n+n]
+
+			// Four rows of B share each loaded value of A.
+			j := jj
+			for ; j+4 <= jEnd; j += 4 {
+				b0 := b[j*k : j*k+k]
+				b1 := b[(j+1)*k : (j+1)*k+k]
+				b2 := b[(j+2)*k : (j+2)*k+k]
+				b3 := b[(j+3)*k : (j+3)*k+k]
+				b0 = b0[:len(aRow)]
+				b1 = b1[:len(aRow)]
+				b2 = b2[:len(aRow)]
+				b3 = b3[:len(aRow)]
+				var s0, s1, s2, s3 float32
+				for l, av := range aRow {
+					s0 += av * b0[l]
+					s1 += av * b1[l]
+					s2 += av * b2[l]
+					s3 += av * b3[l]
+				}
+				cRow[j] = s0
+				cRow[j+1] = s1
+				cRow[j+2] = s2
+				cRow[j+3] = s3
+			}
+			for ; j < jEnd; j++ {
+				bRow := b[j*k : j*k+k]
+				bRow = bRow[:len(aRow)]
+				var s float32
+				for l, av := range aRow {
+					s += av * bRow[l]
+				}
+				cRow[j] = s
+			}
+		}
+	}
+}
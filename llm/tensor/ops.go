@@ -8,18 +8,14 @@ import (
 // Add performs element-wise addition: out = a + b
 func Add(a, b *NDArray) *NDArray {
 	out := New(a.Shape...)
-	for i := range out.Data {
-		out.Data[i] = a.Data[i] + b.Data[i]
-	}
+	AddInto(out, a, b)
 	return out
 }
 
 // Sub performs element-wise subtraction: out = a - b
 func Sub(a, b *NDArray) *NDArray {
 	out := New(a.Shape...)
-	for i := range out.Data {
-		out.Data[i] = a.Data[i] - b.Data[i]
-	}
+	SubInto(out, a, b)
 	return out
 }
 
@@ -29,19 +25,46 @@ func Mul(a, b *NDArray) *NDArray {
 		panic("shape mismatch in Mul")
 	}
 	out := New(a.Shape...)
-	for i := range out.Data {
-		out.Data[i] = a.Data[i] * b.Data[i]
-	}
+	MulInto(out, a, b)
 	return out
 }
 
 // Div performs element-wise division: out = a / b
 func Div(a, b *NDArray) *NDArray {
 	out := New(a.Shape...)
+	DivInto(out, a, b)
+	return out
+}
+
+// The *Into variants write into a preallocated out of the same size, so a
+// backend can run them on disjoint slices of a larger tensor.
+
+// AddInto computes out = a + b
+func AddInto(out, a, b *NDArray) {
+	for i := range out.Data {
+		out.Data[i] = a.Data[i] + b.Data[i]
+	}
+}
+
+// SubInto computes out = a - b
+func SubInto(out, a, b *NDArray) {
+	for i := range out.Data {
+		out.Data[i] = a.Data[i] - b.Data[i]
+	}
+}
+
+// MulInto computes out = a * b
+func MulInto(out, a, b *NDArray) {
+	for i := range out.Data {
+		out.Data[i] = a.Data[i] * b.Data[i]
+	}
+}
+
+// DivInto computes out = a / b
+func DivInto(out, a, b *NDArray) {
 	for i := range out.Data {
 		out.Data[i] = a.Data[i] / b.Data[i]
 	}
-	return out
 }
 
 // MatMulImpl is the function pointer for MatMul. Defaults to PureGoMatMul.
@@ -52,9 +75,10 @@ func MatMul(a, b *NDArray) *NDArray {
 	return MatMulImpl(a, b)
 }
 
-// PureGoMatMul performs generic matrix multiplication in pure Go.
+// NaiveMatMul is the straightforward triple-loop matrix multiplication.
+// It is slow and kept as the reference that faster kernels are checked against.
 // Supports broadcasting for last two dims if rank > 2 (batch matmul).
-func PureGoMatMul(a, b *NDArray) *NDArray {
+func NaiveMatMul(a, b *NDArray) *NDArray {
 	// Assume A is [..., M, K], B is [..., K, N]
 	// If rank 2: [M, K] * [K, N] -> [M, N]
 	// If rank 3: [B, M, K] * [B, K, N] -> [B, M, N]
@@ -156,7 +180,12 @@ func Transpose(t *NDArray) *NDArray {
 // Numerical stability: subtract max.
 func Softmax(t *NDArray) *NDArray {
 	out := New(t.Shape...)
+	SoftmaxInto(out, t)
+	return out
+}
 
+// SoftmaxInto writes Softmax(t) into out.
+func SoftmaxInto(out, t *NDArray) {
 	rank := len(t.Shape)
 	lastDim := t.Shape[rank-1]
 	stride := lastDim
@@ -185,8 +214,6 @@ func Softmax(t *NDArray) *NDArray {
 			out.Data[offset+i] /= sum
 		}
 	}
-
-	return out
 }
 
 // Exp
@@ -263,6 +290,12 @@ func ArgMax(t *NDArray) []int {
 // GELU approx: 0.5 * x * (1 + tanh(sqrt(2/pi) * (x + 0.044715 * x^3)))
 func GELU(t *NDArray) *NDArray {
 	out := New(t.Shape...)
+	GELUInto(out, t)
+	return out
+}
+
+// GELUInto writes GELU(t) into out.
+func GELUInto(out, t *NDArray) {
 	c1 := float32(math.Sqrt(2.0 / math.Pi))
 	c2 := float32(0.044715)
 
@@ -272,7 +305,6 @@ func GELU(t *NDArray) *NDArray {
 		tanh := float32(math.Tanh(float64(inner)))
 		out.Data[i] = 0.5 * x * (1.0 + tanh)
 	}
-	return out
 }
 
 // GELUWithCache computes GELU and returns cache needed for backward pass
@@ -301,7 +333,13 @@ func GELUWithCache(t *NDArray) (*NDArray, *NDArray) {
 // dz/dx = sqrt(2/pi) * (1 + 3 * 0.044715 * x^2)
 func GELUBackward(gradOutput *NDArray, cache *NDArray) *NDArray {
 	gradInput := New(cache.Shape...)
+	GELUBackwardInto(gradInput, gradOutput, cache)
+	return gradInput
+}
 
+// GELUBackwardInto writes the GELU input gradient into gradInput.
+// cache is the GELU input.
+func GELUBackwardInto(gradInput, gradOutput, cache *NDArray) {
 	c1 := float32(math.Sqrt(2.0 / math.Pi))
 	c2 := float32(0.044715)
 
@@ -321,8 +359,57 @@ func GELUBackward(gradOutput *NDArray, cache *NDArray) *NDArray {
 
 		gradInput.Data[i] = gradOutput.Data[i] * dydx
 	}
+}
 
-	return gradInput
+// LayerNorm normalizes over the last dimension:
+// y = (x - mean) / sqrt(var + eps) * gamma + beta
+// Returns y and the per-row mean and 1/std needed for the backward pass.
+func LayerNorm(x, gamma, beta *NDArray, eps float32) (*NDArray, []float32, []float32) {
+	dim := x.Shape[len(x.Shape)-1]
+	batch := x.Size / dim
+
+	out := New(x.Shape...)
+	mean := make([]float32, batch)
+	rstd := make([]float32, batch)
+	LayerNormInto(out, x, gamma, beta, eps, mean, rstd)
+	return out, mean, rstd
+}
+
+// LayerNormInto is LayerNorm writing into out, mean and rstd.
+func LayerNormInto(out, x, gamma, beta *NDArray, eps float32, mean, rstd []float32) {
+	dim := gamma.Size
+	batch := x.Size / dim
+
+	g := gamma.Data
+	bt := beta.Data
+
+	for b := 0; b < batch; b++ {
+		offset := b * dim
+
+		// Mean
+		var sum float32
+		for i := 0; i < dim; i++ {
+			sum += x.Data[offset+i]
+		}
+		m := sum / float32(dim)
+		mean[b] = m
+
+		// Var
+		var sumSq float32
+		for i := 0; i < dim; i++ {
+			diff := x.Data[offset+i] - m
+			sumSq += diff * diff
+		}
+		variance := sumSq / float32(dim)
+		r := float32(1.0 / math.Sqrt(float64(variance)+float64(eps)))
+		rstd[b] = r
+
+		// Normalize and Scale
+		for i := 0; i < dim; i++ {
+			normalized := (x.Data[offset+i] - m) * r
+			out.Data[offset+i] = normalized*g[i] + bt[i]
+		}
+	}
 }
 
 // Clip values
@@ -339,12 +426,23 @@ func Clip(t *NDArray, min, max float32) {
 // Dropout with fixed seed for determinism.
 // Returns (output, mask)
 func Dropout(t *NDArray, p float32) (*NDArray, *NDArray) {
+	return DropoutWithRand(t, p, nil)
+}
+
+// DropoutWithRand is Dropout drawing from r, or from the global
+// math/rand source if r is nil.
+func DropoutWithRand(t *NDArray, p float32, r *rand.Rand) (*NDArray, *NDArray) {
 	out := New(t.Shape...)
 	mask := New(t.Shape...)
 	scale := 1.0 / (1.0 - p)
 
+	draw := rand.Float32
+	if r != nil {
+		draw = r.Float32
+	}
+
 	for i := range t.Data {
-		if rand.Float32() > p {
+		if draw() > p {
 			mask.Data[i] = 1.0
 			out.Data[i] = t.Data[i] * scale
 		} else {
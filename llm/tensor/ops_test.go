@@ -68,3 +68,71 @@ func TestGELU(t *testing.T) {
 		t.Errorf("Expected 0, got %f", g.Data[0])
 	}
 }
+
+func TestPureGoMatMulMatchesNaive(t *testing.T) {
+	defer func(w int) { MatMulWorkers = w }(MatMulWorkers)
+
+	// Odd sizes exercise the partial tiles and the 4-row remainder.
+	shapes := [][2][]int{
+		{{3, 5}, {5, 2}},
+		{{2, 37, 130}, {2, 130, 129}},
+		{{70, 300}, {300, 9}},
+	}
+	for _, s := range shapes {
+		a := NewRandom(s[0]...)
+		b := NewRandom(s[1]...)
+		want := NaiveMatMul(a, b)
+
+		MatMulWorkers = 1
+		serial := PureGoMatMul(a, b)
+		for i, v := range want.Data {
+			if math.Abs(float64(v-serial.Data[i])) > 1e-4 {
+				t.Fatalf("%v x %v at %d: expected %f, got %f", a.Shape, b.Shape, i, v, serial.Data[i])
+			}
+		}
+
+		// Results must not depend on the worker count.
+		MatMulWorkers = 4
+		parallel := PureGoMatMul(a, b)
+		for i, v := range serial.Data {
+			if parallel.Data[i] != v {
+				t.Fatalf("%v x %v at %d: 1 worker %v, 4 workers %v", a.Shape, b.Shape, i, v, parallel.Data[i])
+			}
+		}
+	}
+}
+
+func TestTransposedMatMulMatchesNaive(t *testing.T) {
+	shapes := [][2][]int{
+		{{3, 5}, {2, 5}},
+		{{2, 37, 130}, {2, 69, 130}},
+		{{70, 300}, {9, 300}},
+	}
+	for _, s := range shapes {
+		a := NewRandom(s[0]...)
+		b := NewRandom(s[1]...)
+
+		// a x b^T
+		want := NaiveMatMul(a, Transpose(b))
+		for _, workers := range []int{1, 4} {
+			got := BatchedMatMul(a, b, false, true, workers)
+			for i, v := range want.Data {
+				if math.Abs(float64(v-got.Data[i])) > 1e-4 {
+					t.Fatalf("NT %v x %v at %d: expected %f, got %f", a.Shape, b.Shape, i, v, got.Data[i])
+				}
+			}
+		}
+
+		// a^T x b, reusing the transposes as stored operands
+		at, bt := Transpose(a), Transpose(b)
+		want = NaiveMatMul(a, bt)
+		for _, workers := range []int{1, 4} {
+			got := BatchedMatMul(at, bt, true, false, workers)
+			for i, v := range want.Data {
+				if math.Abs(float64(v-got.Data[i])) > 1e-4 {
+					t.Fatalf("TN %v x %v at %d: expected %f, got %f", at.Shape, bt.Shape, i, v, got.Data[i])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package tensor
+
+// RNGSource is a math/rand Source whose complete state is a single uint64,
+// so it can be checkpointed and restored exactly (splitmix64).
+// Use it with rand.New to get a *rand.Rand.
+type RNGSource struct {
+	state uint64
+}
+
+// NewRNGSource returns a source seeded with seed.
+func NewRNGSource(seed int64) *RNGSource {
+	return &RNGSource{state: uint64(seed)}
+}
+
+// Uint64 returns the next pseudo-random value.
+func (s *RNGSource) Uint64() uint64 {
+	s.state += 0x9e3779b97f4a7c15
+	z := s.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// Int63 returns a non-negative pseudo-random 63-bit integer.
+func (s *RNGSource) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+// Seed resets the source to the given seed.
+func (s *RNGSource) Seed(seed int64) {
+	s.state = uint64(seed)
+}
+
+// State returns the current state for checkpointing.
+func (s *RNGSource) State() uint64 {
+	return s.state
+}
+
+// SetState restores a state previously returned by State.
+func (s *RNGSource) SetState(state uint64) {
+	s.state = state
+}
@@ -4,111 +4,99 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 )
 
-type Tokenizer struct {
+// BPE is a byte-level byte pair encoding tokenizer.
+type BPE struct {
 	Vocab    map[int]string // id -> token (bytes)
 	Merges   map[string]int // pair "u,v" -> rank
 	Encoder  map[string]int // token (bytes) -> id
 	Decoder  map[int]string // id -> string
-	VocabSize int
+	Size     int            `json:"VocabSize"`
+	Pattern  string // Pre-tokenization regexp, empty for raw bytes (see SetPattern)
+	Special  map[string]int // Special token -> id, after all merges (see AddSpecial)
+
+	// Imported vocabularies (see import.go) number tokens their own way.
+	// Trained tokenizers leave these empty: byte b is token b and a merge
+	// produces the token whose id is its rank.
+	ByteIDs  []int          `json:",omitempty"` // Byte -> id
+	MergeIDs map[string]int `json:",omitempty"` // Pair "u,v" -> id of the merged token
+
+	mu  sync.Mutex
+	enc *encoder // Built from Merges on first Encode
 }
 
-func New() *Tokenizer {
-	return &Tokenizer{
-		Vocab:    make(map[int]string),
-		Merges:   make(map[string]int),
-		Encoder:  make(map[string]int),
-		Decoder:  make(map[int]string),
-		VocabSize: 256, // Start with bytes
+// New returns an untrained BPE tokenizer.
+func New() *BPE {
+	return &BPE{
+		Vocab:   make(map[int]string),
+		Merges:  make(map[string]int),
+		Encoder: make(map[string]int),
+		Decoder: make(map[int]string),
+		Size:    256, // Start with bytes
 	}
 }
 
-// Train logic: simplified
-func (t *Tokenizer) Train(text string, vocabSize int) {
-	// 1. Initialize with all bytes
-	for i := 0; i < 256; i++ {
-		b := string([]byte{byte(i)})
-		t.Encoder[b] = i
-		t.Decoder[i] = b
-	}
-	
-	// Convert text to list of integers (bytes)
-	ids := make([]int, len(text))
-	for i := 0; i < len(text); i++ {
-		ids[i] = int(text[i])
+func (t *BPE) Type() string { return TypeBPE }
+
+func (t *BPE) VocabSize() int { return t.Size }
+
+// Train learns merges from text until the vocabulary (including registered
+// special tokens) has vocabSize tokens or no adjacent pair is left. The most frequent pair is merged first; ties go
+// to the pair with the smallest ids.
+//
+// With a split pattern, merges are learned within pieces only, and each
+// distinct piece is processed once with its count.
+func (t *BPE) Train(text string, vocabSize int) {
+	// Special tokens are boundaries; they are never part of a merge
+	spans := splitSpecial(text, specialSet(t.Special))
+
+	if t.Pattern == "" {
+		var words [][]byte
+		var counts []int
+		for _, span := range spans {
+			if _, ok := t.Special[span]; !ok {
+				words = append(words, []byte(span))
+				counts = append(counts, 1)
+			}
+		}
+		t.trainWords(words, counts, vocabSize-len(t.Special))
+		return
 	}
-	
-	numMerges := vocabSize - 256
-	for i := 0; i < numMerges; i++ {
-		stats := getStats(ids)
-		if len(stats) == 0 {
-			break
+
+	index := make(map[string]int)
+	var words [][]byte
+	var counts []int
+	for _, span := range spans {
+		if _, ok := t.Special[span]; ok {
+			continue
+		}
+		for _, piece := range t.Pretokenize(span) {
+			i, ok := index[piece]
+			if !ok {
+				i = len(words)
+				index[piece] = i
+				words = append(words, []byte(piece))
+				counts = append(counts, 0)
+			}
+			counts[i]++
 		}
-		
-		pair := getMax(stats)
-		idx := 256 + i
-		
-		// Record merge
-		key := fmt.Sprintf("%d,%d", pair.a, pair.b)
-		t.Merges[key] = idx
-		
-		// New token
-		tokenBytes := t.Decoder[pair.a] + t.Decoder[pair.b]
-		t.Decoder[idx] = tokenBytes
-		t.Encoder[tokenBytes] = idx
-		
-		// Apply merge
-		ids = merge(ids, pair, idx)
 	}
-	t.VocabSize = 256 + len(t.Merges)
+	t.trainWords(words, counts, vocabSize-len(t.Special))
 }
 
-func (t *Tokenizer) Encode(text string) []int {
+// Encode converts text to token ids by applying merges in rank order.
+func (t *BPE) Encode(text string) []int {
 	if len(t.Encoder) == 0 {
 		return nil
 	}
-	
-	ids := make([]int, len(text))
-	for i := 0; i < len(text); i++ {
-		ids[i] = int(text[i])
-	}
-	
-	for {
-		stats := getStats(ids)
-		if len(stats) == 0 {
-			break
-		}
-		
-		// Find lowest rank pair
-		minRank := 10000000
-		var bestPair pair
-		found := false
-		
-		for p := range stats {
-			key := fmt.Sprintf("%d,%d", p.a, p.b)
-			rank, ok := t.Merges[key]
-			if ok {
-				if rank < minRank {
-					minRank = rank
-					bestPair = p
-					found = true
-				}
-			}
-		}
-		
-		if !found {
-			break
-		}
-		
-		ids = merge(ids, bestPair, minRank)
-	}
-	
-	return ids
+	return t.encoder().encode(text, nil)
 }
 
-func (t *Tokenizer) Decode(ids []int) string {
+func (t *BPE) Decode(ids []int) string {
 	var sb strings.Builder
 	for _, id := range ids {
 		sb.WriteString(t.Decoder[id])
@@ -116,15 +104,21 @@ func (t *Tokenizer) Decode(ids []int) string {
 	return sb.String()
 }
 
-func (t *Tokenizer) Save(path string) error {
-	data, err := json.Marshal(t)
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(path, data, 0644)
+// Token returns the bytes of token id.
+func (t *BPE) Token(id int) (string, bool) {
+	tok, ok := t.Decoder[id]
+	return tok, ok
 }
 
-func Load(path string) (*Tokenizer, error) {
+func (t *BPE) Save(path string) error {
+	return saveJSON(path, struct {
+		Type string
+		*BPE
+	}{TypeBPE, t})
+}
+
+// LoadBPE reads a BPE tokenizer written by Save.
+func LoadBPE(path string) (*BPE, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
@@ -133,46 +127,88 @@ func Load(path string) (*Tokenizer, error) {
 	if err := json.Unmarshal(data, t); err != nil {
 		return nil, err
 	}
+	if t.Pattern != "" {
+		if _, err := newSplitter(t.Pattern); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	t.rebuildVocab()
 	return t, nil
 }
 
-// Helpers
-type pair struct {
-	a, b int
-}
-
-func getStats(ids []int) map[pair]int {
-	counts := make(map[pair]int)
-	for i := 0; i < len(ids)-1; i++ {
-		p := pair{ids[i], ids[i+1]}
-		counts[p]++
+// byteID returns the token of the single byte b.
+func (t *BPE) byteID(b byte) int {
+	if len(t.ByteIDs) == 256 {
+		return t.ByteIDs[b]
 	}
-	return counts
+	return int(b)
 }
 
-func getMax(stats map[pair]int) pair {
-	maxVal := -1
-	var best pair
-	for p, v := range stats {
-		if v > maxVal {
-			maxVal = v
-			best = p
+// mergeRule is one entry of Merges: a followed by b becomes id.
+type mergeRule struct{ a, b, rank, id int }
+
+// mergeRules parses Merges, ordered by rank.
+func (t *BPE) mergeRules() []mergeRule {
+	rules := make([]mergeRule, 0, len(t.Merges))
+	for key, rank := range t.Merges {
+		var a, b int
+		if _, err := fmt.Sscanf(key, "%d,%d", &a, &b); err != nil {
+			continue
+		}
+		id := rank
+		if mid, ok := t.MergeIDs[key]; ok {
+			id = mid
 		}
+		rules = append(rules, mergeRule{a, b, rank, id})
 	}
-	return best
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].rank != rules[j].rank {
+			return rules[i].rank < rules[j].rank
+		}
+		return rules[i].id < rules[j].id
+	})
+	return rules
 }
 
-func merge(ids []int, p pair, idx int) []int {
-	newIds := make([]int, 0, len(ids))
-	i := 0
-	for i < len(ids) {
-		if i < len(ids)-1 && ids[i] == p.a && ids[i+1] == p.b {
-			newIds = append(newIds, idx)
-			i += 2
-		} else {
-			newIds = append(newIds, ids[i])
-			i++
+// rebuildVocab recomputes the bytes of every merged token from Merges.
+// JSON stores strings as UTF-8, so tokens holding partial characters
+// (e.g. single bytes >= 0x80) do not survive Save and Load on their own.
+func (t *BPE) rebuildVocab() {
+	dec := make(map[int]string, len(t.Decoder))
+	for i := 0; i < 256; i++ {
+		dec[t.byteID(byte(i))] = string([]byte{byte(i)})
+	}
+	// Imported merges need not rank after the tokens they join, so repeat
+	// until every merge whose parts are known has been resolved
+	pending := t.mergeRules()
+	for len(pending) > 0 {
+		rest := pending[:0]
+		for _, r := range pending {
+			a, okA := dec[r.a]
+			b, okB := dec[r.b]
+			if !okA || !okB {
+				rest = append(rest, r)
+				continue
+			}
+			dec[r.id] = a + b
+		}
+		if len(rest) == len(pending) {
+			break
 		}
+		pending = rest
+	}
+	for tok, id := range t.Special {
+		dec[id] = tok
+	}
+	// Anything else (tokens no merge produces) is kept as loaded
+	for id, tok := range t.Decoder {
+		if _, ok := dec[id]; !ok {
+			dec[id] = tok
+		}
+	}
+	t.Decoder = dec
+	t.Encoder = make(map[string]int, len(dec))
+	for id, tok := range dec {
+		t.Encoder[tok] = id
 	}
-	return newIds
 }
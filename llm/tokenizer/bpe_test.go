@@ -0,0 +1,191 @@
+package tokenizer
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// naiveEncode is the original encoder: repeatedly merge every occurrence of
+// the lowest-ranked pair present.
+func naiveEncode(t *BPE, text string) []int {
+	ids := make([]int, len(text))
+	for i := 0; i < len(text); i++ {
+		ids[i] = int(text[i])
+	}
+	for {
+		minRank := -1
+		var best pair
+		for p := range getStats(ids) {
+			rank, ok := t.Merges[fmt.Sprintf("%d,%d", p.a, p.b)]
+			if ok && (minRank < 0 || rank < minRank) {
+				minRank, best = rank, p
+			}
+		}
+		if minRank < 0 {
+			return ids
+		}
+		ids = merge(ids, best, minRank)
+	}
+}
+
+// naiveTrain is the original full-rescan trainer with the same tie-break as
+// Train: highest count, then smallest (a, b).
+func naiveTrain(text string, vocabSize int) map[string]int {
+	ids := make([]int, len(text))
+	for i := 0; i < len(text); i++ {
+		ids[i] = int(text[i])
+	}
+	merges := make(map[string]int)
+	for idx := 256; idx < vocabSize; idx++ {
+		stats := getStats(ids)
+		if len(stats) == 0 {
+			break
+		}
+		var best pair
+		bestCount := -1
+		for p, c := range stats {
+			if c > bestCount || c == bestCount && (p.a < best.a || p.a == best.a && p.b < best.b) {
+				best, bestCount = p, c
+			}
+		}
+		merges[fmt.Sprintf("%d,%d", best.a, best.b)] = idx
+		ids = merge(ids, best, idx)
+	}
+	return merges
+}
+
+func TestTrainMatchesNaive(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	texts := []string{
+		"aaaaaaa",    // Overlapping pairs
+		"abababab a", // Merges that create the next pair
+		"the cat sat on the mat. the cat ate the rat.",
+	}
+	// Small alphabet so long repeats and ties are common
+	var sb strings.Builder
+	for i := 0; i < 3000; i++ {
+		sb.WriteByte("ab c"[r.Intn(4)])
+	}
+	texts = append(texts, sb.String())
+
+	for _, text := range texts {
+		want := naiveTrain(text, 400)
+
+		tok := New()
+		tok.Train(text, 400)
+
+		if len(tok.Merges) != len(want) {
+			t.Fatalf("%.20q: %d merges, want %d", text, len(tok.Merges), len(want))
+		}
+		for k, v := range want {
+			if tok.Merges[k] != v {
+				t.Fatalf("%.20q: merge %s has rank %d, want %d", text, k, tok.Merges[k], v)
+			}
+		}
+		if tok.Size != 256+len(want) {
+			t.Errorf("VocabSize %d, want %d", tok.Size, 256+len(want))
+		}
+		if got := tok.Decode(tok.Encode(text)); got != text {
+			t.Errorf("round trip changed %.20q", text)
+		}
+	}
+}
+
+func TestEncodeMatchesNaive(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	randomText := func(n int) string {
+		var sb strings.Builder
+		for i := 0; i < n; i++ {
+			sb.WriteByte("ab c\n"[r.Intn(5)])
+		}
+		return sb.String()
+	}
+
+	trained := New()
+	trained.Train(randomText(5000)+"the cat sat on the mat ↓↓ héé ↓", 600)
+
+	// Encode must only depend on what survives Save and Load
+	path := t.TempDir() + "/tokenizer.json"
+	if err := trained.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	tok, err := LoadBPE(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	texts := []string{"", "a", "aaaaaaaaa", "the cat sat on the mat", "héllo, wörld ↓↓"}
+	for i := 0; i < 20; i++ {
+		texts = append(texts, randomText(r.Intn(400)))
+	}
+
+	for _, text := range texts {
+		want := naiveEncode(tok, text)
+		got := tok.Encode(text)
+		if !sameIDs(got, want) {
+			t.Fatalf("Encode(%.20q) = %v, want %v", text, got, want)
+		}
+		// Second call is served from the cache
+		if got := tok.Encode(text); !sameIDs(got, want) {
+			t.Fatalf("cached Encode(%.20q) = %v, want %v", text, got, want)
+		}
+	}
+
+	for i, ids := range tok.EncodeBatch(texts) {
+		if !sameIDs(ids, naiveEncode(tok, texts[i])) {
+			t.Fatalf("EncodeBatch differs from Encode for %.20q", texts[i])
+		}
+	}
+
+	var ids []int
+	big := randomText(2*readBlock + 123)
+	ids, err = tok.EncodeReader(strings.NewReader(big))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameIDs(ids, tok.Encode(big)) {
+		t.Fatalf("EncodeReader differs from Encode")
+	}
+}
+
+func sameIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type pair struct {
+	a, b int
+}
+
+func getStats(ids []int) map[pair]int {
+	counts := make(map[pair]int)
+	for i := 0; i < len(ids)-1; i++ {
+		p := pair{ids[i], ids[i+1]}
+		counts[p]++
+	}
+	return counts
+}
+
+func merge(ids []int, p pair, idx int) []int {
+	newIds := make([]int, 0, len(ids))
+	i := 0
+	for i < len(ids) {
+		if i < len(ids)-1 && ids[i] == p.a && ids[i+1] == p.b {
+			newIds = append(newIds, idx)
+			i += 2
+		} else {
+			newIds = append(newIds, ids[i])
+			i++
+		}
+	}
+	return newIds
+}
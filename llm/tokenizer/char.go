@@ -0,0 +1,150 @@
+package tokenizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// unknownChar is token 0 of a Char tokenizer: every character outside the
+// vocabulary encodes to it.
+const unknownChar = "�"
+
+// Char is a character-level tokenizer for tiny experiments: each character
+// seen in training is one token, ordered by code point.
+type Char struct {
+	Chars   []string       // id -> character; Chars[0] is unknownChar
+	Special map[string]int // Special token -> id, after the characters
+
+	index map[rune]int
+}
+
+// NewChar returns an untrained character tokenizer.
+func NewChar() *Char {
+	return &Char{Chars: []string{unknownChar}}
+}
+
+func (c *Char) Type() string { return TypeChar }
+
+func (c *Char) VocabSize() int { return len(c.Chars) + len(c.Special) }
+
+// Train keeps the vocabSize most frequent characters of text (fewer if
+// there are fewer), counting the unknown and special tokens. Ties go to
+// the lower code point.
+func (c *Char) Train(text string, vocabSize int) {
+	counts := make(map[rune]int)
+	for _, span := range splitSpecial(text, specialSet(c.Special)) {
+		if _, ok := c.Special[span]; ok {
+			continue
+		}
+		for _, r := range span {
+			if r != utf8.RuneError {
+				counts[r]++
+			}
+		}
+	}
+
+	chars := make([]rune, 0, len(counts))
+	for r := range counts {
+		chars = append(chars, r)
+	}
+	sort.Slice(chars, func(i, j int) bool {
+		if counts[chars[i]] != counts[chars[j]] {
+			return counts[chars[i]] > counts[chars[j]]
+		}
+		return chars[i] < chars[j]
+	})
+	if keep := max(vocabSize-1-len(c.Special), 0); len(chars) > keep {
+		chars = chars[:keep]
+	}
+	sort.Slice(chars, func(i, j int) bool { return chars[i] < chars[j] })
+
+	c.Chars = []string{unknownChar}
+	for _, r := range chars {
+		c.Chars = append(c.Chars, string(r))
+	}
+	// Special tokens follow the characters, keeping their order
+	for i, tok := range specialTokens(c.Special) {
+		c.Special[tok] = len(c.Chars) + i
+	}
+	c.reindex()
+}
+
+func (c *Char) reindex() {
+	c.index = make(map[rune]int, len(c.Chars))
+	for id, ch := range c.Chars[1:] {
+		r, _ := utf8.DecodeRuneInString(ch)
+		c.index[r] = id + 1
+	}
+}
+
+// Encode returns one id per character of text.
+func (c *Char) Encode(text string) []int {
+	ids := make([]int, 0, len(text))
+	for _, r := range text {
+		ids = append(ids, c.index[r]) // 0 if unknown
+	}
+	return ids
+}
+
+func (c *Char) EncodeWithPolicy(text string, p SpecialPolicy) ([]int, error) {
+	return encodeWithPolicy(c.Special, c.Encode, text, p)
+}
+
+func (c *Char) Decode(ids []int) string {
+	var sb strings.Builder
+	for _, id := range ids {
+		tok, _ := c.Token(id)
+		sb.WriteString(tok)
+	}
+	return sb.String()
+}
+
+func (c *Char) Token(id int) (string, bool) {
+	if id >= 0 && id < len(c.Chars) {
+		return c.Chars[id], true
+	}
+	return specialToken(c.Special, id)
+}
+
+// AddSpecial registers special tokens after the current vocabulary.
+func (c *Char) AddSpecial(tokens ...string) {
+	c.Special = addSpecial(c.Special, c.VocabSize(), tokens)
+}
+
+func (c *Char) SpecialID(tok string) (int, bool) {
+	id, ok := c.Special[tok]
+	return id, ok
+}
+
+func (c *Char) Save(path string) error {
+	return saveJSON(path, struct {
+		Type string
+		*Char
+	}{TypeChar, c})
+}
+
+// LoadChar reads a character tokenizer written by Save.
+func LoadChar(path string) (*Char, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := NewChar()
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	if len(c.Chars) == 0 || c.Chars[0] != unknownChar {
+		return nil, fmt.Errorf("%s: character vocabulary must start with %q", path, unknownChar)
+	}
+	for _, ch := range c.Chars[1:] {
+		if utf8.RuneCountInString(ch) != 1 {
+			return nil, fmt.Errorf("%s: %q is not a single character", path, ch)
+		}
+	}
+	c.reindex()
+	return c, nil
+}
@@ -0,0 +1,461 @@
+package tokenizer
+
+import (
+	"container/list"
+	"io"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// Chunks up to this many bytes are cached; longer ones rarely repeat.
+	maxCachedChunk = 256
+	cacheEntries   = 1 << 14
+
+	// EncodeReader reads this much at a time before cutting at a chunk boundary.
+	readBlock = 1 << 20
+)
+
+// encoder is the lookup structure Encode runs on, derived from Merges.
+//
+// Text is cut into chunks wherever two adjacent bytes appear together in no
+// token of the vocabulary: no merge can ever join them, so each chunk can be
+// encoded on its own (and cached) with exactly the same result.
+//
+// With a split pattern the pieces it produces are the chunks instead.
+type encoder struct {
+	ranks    map[uint64]mergeRank // pairKey(a, b) -> merge
+	byteIDs  [256]int32           // Token of each single byte
+	joinable []bool               // [a<<8|b]: bytes a, b occur next to each other in some token
+	split    *splitter            // nil without a pattern
+	cache    *lruCache
+}
+
+type mergeRank struct {
+	rank int32 // Lower merges first
+	id   int32 // Token produced
+}
+
+// encoder returns the encoder for the current merges, building it on first use.
+func (t *BPE) encoder() *encoder {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.enc == nil {
+		t.enc = newEncoder(t)
+	}
+	return t.enc
+}
+
+// invalidate drops the encoder after the merges changed.
+func (t *BPE) invalidate() {
+	t.mu.Lock()
+	t.enc = nil
+	t.mu.Unlock()
+}
+
+func newEncoder(t *BPE) *encoder {
+	e := &encoder{
+		ranks:    make(map[uint64]mergeRank, len(t.Merges)),
+		joinable: make([]bool, 1<<16),
+		cache:    newLRUCache(cacheEntries),
+	}
+	if t.Pattern != "" {
+		split, err := newSplitter(t.Pattern)
+		if err != nil {
+			panic(err) // SetPattern and Load reject invalid patterns
+		}
+		e.split = split
+	}
+	for i := range e.byteIDs {
+		e.byteIDs[i] = int32(t.byteID(byte(i)))
+	}
+	for _, r := range t.mergeRules() {
+		e.ranks[pairKey(int32(r.a), int32(r.b))] = mergeRank{rank: int32(r.rank), id: int32(r.id)}
+		// A merge joins the last byte of a to the first byte of b; bigrams
+		// inside a and b were joined by other merges
+		a, b := t.Decoder[r.a], t.Decoder[r.b]
+		if a != "" && b != "" {
+			e.joinable[int(a[len(a)-1])<<8|int(b[0])] = true
+		}
+	}
+	return e
+}
+
+// encode appends the ids of text to out.
+func (e *encoder) encode(text string, out []int) []int {
+	if e.split != nil {
+		for len(text) > 0 {
+			n := e.split.next(text)
+			out = e.encodeChunk(text[:n], out)
+			text = text[n:]
+		}
+		return out
+	}
+
+	start := 0
+	for i := 1; i <= len(text); i++ {
+		if i < len(text) && e.joinable[int(text[i-1])<<8|int(text[i])] {
+			continue
+		}
+		out = e.encodeChunk(text[start:i], out)
+		start = i
+	}
+	return out
+}
+
+func (e *encoder) encodeChunk(chunk string, out []int) []int {
+	if len(chunk) == 1 {
+		return append(out, int(e.byteIDs[chunk[0]]))
+	}
+	if len(chunk) > maxCachedChunk {
+		return e.bpeLarge(chunk, out)
+	}
+	if ids, ok := e.cache.get(chunk); ok {
+		return append(out, ids...)
+	}
+	n := len(out)
+	out = e.bpe(chunk, out)
+	e.cache.put(strings.Clone(chunk), append([]int(nil), out[n:]...))
+	return out
+}
+
+// bpe applies merges to chunk in rank order. Occurrences of the same pair
+// merge left to right, exactly like repeatedly merging every occurrence of
+// the lowest-ranked pair present.
+func (e *encoder) bpe(chunk string, out []int) []int {
+	n := len(chunk)
+	ids := make([]int32, n)
+	next := make([]int32, n)
+	prev := make([]int32, n)
+	for i := range ids {
+		ids[i] = e.byteIDs[chunk[i]]
+		next[i] = int32(i + 1)
+		prev[i] = int32(i - 1)
+	}
+	next[n-1] = -1
+
+	var h candidateHeap
+	push := func(pos int32) {
+		q := next[pos]
+		if q < 0 {
+			return
+		}
+		k := pairKey(ids[pos], ids[q])
+		if m, ok := e.ranks[k]; ok {
+			h.push(candidate{rank: m.rank, pos: pos, key: k})
+		}
+	}
+	for i := int32(0); i < int32(n-1); i++ {
+		push(i)
+	}
+
+	for len(h) > 0 {
+		c := h.pop()
+		// Stale if either side was merged since the candidate was pushed
+		q := next[c.pos]
+		if ids[c.pos] < 0 || q < 0 || pairKey(ids[c.pos], ids[q]) != c.key {
+			continue
+		}
+
+		ids[c.pos] = e.ranks[c.key].id
+		ids[q] = -1
+		next[c.pos] = next[q]
+		if next[q] >= 0 {
+			prev[next[q]] = c.pos
+		}
+
+		// New pairs always rank after c, so order is preserved
+		if p := prev[c.pos]; p >= 0 {
+			push(p)
+		}
+		push(c.pos)
+	}
+
+	for i := int32(0); i >= 0; i = next[i] {
+		out = append(out, int(ids[i]))
+	}
+	return out
+}
+
+// bpeLarge is bpe for long chunks. The heap holds one entry per rank and
+// each rank keeps its own positions, so the heap stays small however long
+// the chunk is.
+func (e *encoder) bpeLarge(chunk string, out []int) []int {
+	n := len(chunk)
+	ids := make([]int32, n)
+	next := make([]int32, n)
+	prev := make([]int32, n)
+	for i := range ids {
+		ids[i] = e.byteIDs[chunk[i]]
+		next[i] = int32(i + 1)
+		prev[i] = int32(i - 1)
+	}
+	next[n-1] = -1
+
+	var h candidateHeap
+	buckets := make(map[int32][]int32)
+	push := func(pos int32) {
+		q := next[pos]
+		if q < 0 {
+			return
+		}
+		if m, ok := e.ranks[pairKey(ids[pos], ids[q])]; ok {
+			if len(buckets[m.rank]) == 0 {
+				h.push(candidate{rank: m.rank})
+			}
+			buckets[m.rank] = append(buckets[m.rank], pos)
+		}
+	}
+	for i := int32(0); i < int32(n-1); i++ {
+		push(i)
+	}
+
+	for len(h) > 0 {
+		rank := h.pop().rank
+		positions := buckets[rank]
+		delete(buckets, rank) // New pairs always rank after this one
+		slices.Sort(positions)
+
+		for _, pos := range positions {
+			q := next[pos]
+			if ids[pos] < 0 || q < 0 {
+				continue
+			}
+			m, ok := e.ranks[pairKey(ids[pos], ids[q])]
+			if !ok || m.rank != rank {
+				continue
+			}
+
+			ids[pos] = m.id
+			ids[q] = -1
+			next[pos] = next[q]
+			if next[q] >= 0 {
+				prev[next[q]] = pos
+			}
+
+			if p := prev[pos]; p >= 0 {
+				push(p)
+			}
+			push(pos)
+		}
+	}
+
+	for i := int32(0); i >= 0; i = next[i] {
+		out = append(out, int(ids[i]))
+	}
+	return out
+}
+
+// EncodeBatch encodes texts in parallel. The result is identical to calling
+// Encode on each text.
+func (t *BPE) EncodeBatch(texts []string) [][]int {
+	out := make([][]int, len(texts))
+	if len(t.Encoder) == 0 {
+		return out
+	}
+	e := t.encoder()
+
+	workers := min(runtime.GOMAXPROCS(0), len(texts))
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1) - 1)
+				if i >= len(texts) {
+					return
+				}
+				out[i] = e.encode(texts[i], nil)
+			}
+		}()
+	}
+	wg.Wait()
+	return out
+}
+
+// EncodeReader encodes everything read from r, working on blocks of about a
+// megabyte in parallel. The result is identical to Encode on the whole input.
+func (t *BPE) EncodeReader(r io.Reader) ([]int, error) {
+	var out []int
+	err := t.EncodeStream(r, func(ids []int) error {
+		out = append(out, ids...)
+		return nil
+	})
+	return out, err
+}
+
+// EncodeStream is EncodeReader for inputs too large to hold their ids: emit
+// receives the ids in order, a few megabytes of input at a time.
+func (t *BPE) EncodeStream(r io.Reader, emit func(ids []int) error) error {
+	if len(t.Encoder) == 0 {
+		return nil
+	}
+	e := t.encoder()
+	workers := runtime.GOMAXPROCS(0)
+
+	var blocks []string
+	flush := func() error {
+		for _, ids := range t.EncodeBatch(blocks) {
+			if err := emit(ids); err != nil {
+				return err
+			}
+		}
+		blocks = blocks[:0]
+		return nil
+	}
+
+	var pending []byte
+	buf := make([]byte, readBlock)
+	for {
+		n, err := io.ReadFull(r, buf)
+		pending = append(pending, buf[:n]...)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			blocks = append(blocks, string(pending))
+			return flush()
+		}
+		if err != nil {
+			return err
+		}
+
+		// Cut at the last chunk boundary; the tail waits for more input
+		if cut := e.lastBoundary(pending); cut > 0 {
+			blocks = append(blocks, string(pending[:cut]))
+			pending = append(pending[:0:0], pending[cut:]...)
+		}
+		if len(blocks) >= workers {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// lastBoundary returns the largest i > 0 such that data may be encoded as
+// data[:i] and data[i:] independently, or 0 if there is none.
+//
+// With a split pattern that is after a newline followed by non-whitespace,
+// which no piece of the preset patterns spans. Custom patterns must not
+// match across such a point either.
+func (e *encoder) lastBoundary(data []byte) int {
+	if e.split != nil {
+		for i := len(data) - 1; i > 0; i-- {
+			if data[i-1] == '\n' && !isSpace(data[i]) {
+				return i
+			}
+		}
+		return 0
+	}
+	for i := len(data) - 1; i > 0; i-- {
+		if !e.joinable[int(data[i-1])<<8|int(data[i])] {
+			return i
+		}
+	}
+	return 0
+}
+
+// candidate is a pair that may be merged at pos (bpeLarge only uses rank).
+type candidate struct {
+	rank int32
+	pos  int32
+	key  uint64
+}
+
+// candidateHeap is a min-heap by rank, then position.
+type candidateHeap []candidate
+
+func (h candidateHeap) less(i, j int) bool {
+	if h[i].rank != h[j].rank {
+		return h[i].rank < h[j].rank
+	}
+	return h[i].pos < h[j].pos
+}
+
+func (h *candidateHeap) push(c candidate) {
+	*h = append(*h, c)
+	s := *h
+	for i := len(s) - 1; i > 0; {
+		p := (i - 1) / 2
+		if !s.less(i, p) {
+			break
+		}
+		s[i], s[p] = s[p], s[i]
+		i = p
+	}
+}
+
+func (h *candidateHeap) pop() candidate {
+	s := *h
+	top := s[0]
+	last := len(s) - 1
+	s[0] = s[last]
+	s = s[:last]
+	for i := 0; ; {
+		l, r, m := 2*i+1, 2*i+2, i
+		if l < len(s) && s.less(l, m) {
+			m = l
+		}
+		if r < len(s) && s.less(r, m) {
+			m = r
+		}
+		if m == i {
+			break
+		}
+		s[i], s[m] = s[m], s[i]
+		i = m
+	}
+	*h = s
+	return top
+}
+
+// lruCache maps chunks to their ids, evicting the least recently used.
+// It is safe for concurrent use.
+type lruCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // Front is most recent
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key string
+	ids []int
+}
+
+func newLRUCache(size int) *lruCache {
+	return &lruCache{
+		size:  size,
+		order: list.New(),
+		items: make(map[string]*list.Element, size),
+	}
+}
+
+func (c *lruCache) get(key string) ([]int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*lruEntry).ids, true
+}
+
+func (c *lruCache) put(key string, ids []int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruEntry{key: key, ids: ids})
+	if c.order.Len() > c.size {
+		el := c.order.Back()
+		c.order.Remove(el)
+		delete(c.items, el.Value.(*lruEntry).key)
+	}
+}
@@ -0,0 +1,437 @@
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Importers for vocabularies trained elsewhere. They produce an ordinary
+// Tokenizer that encodes exactly like the original, can be saved with Save
+// and reloaded with Load. Tokens keep their original ids, so byte tokens are
+// recorded in ByteIDs and merged tokens in MergeIDs.
+
+// byteLevelAlphabet is GPT-2's bytes_to_unicode: printable Latin-1 bytes
+// stand for themselves, the others for the runes from U+0100 on, in order.
+// GPT-2 and Hugging Face byte-level files store tokens in this alphabet.
+func byteLevelAlphabet() map[rune]byte {
+	m := make(map[rune]byte, 256)
+	n := 0
+	for b := 0; b < 256; b++ {
+		if b >= '!' && b <= '~' || b >= 0xA1 && b <= 0xAC || b >= 0xAE && b <= 0xFF {
+			m[rune(b)] = byte(b)
+		} else {
+			m[rune(256+n)] = byte(b)
+			n++
+		}
+	}
+	return m
+}
+
+// decodeByteLevel converts a token written in the byte-level alphabet back
+// to its bytes.
+func decodeByteLevel(alphabet map[rune]byte, s string) (string, error) {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		b, ok := alphabet[r]
+		if !ok {
+			return "", fmt.Errorf("token %q is not byte-level encoded", s)
+		}
+		out = append(out, b)
+	}
+	return string(out), nil
+}
+
+// importer collects a vocabulary and its merges into a Tokenizer.
+type importer struct {
+	t     *BPE
+	vocab map[string]int // Token bytes -> id
+}
+
+func newImporter(vocab map[string]int) (*importer, error) {
+	t := New()
+	t.ByteIDs = make([]int, 256)
+	t.MergeIDs = make(map[string]int)
+	t.Size = 0
+	for b := 0; b < 256; b++ {
+		id, ok := vocab[string([]byte{byte(b)})]
+		if !ok {
+			return nil, fmt.Errorf("vocabulary has no token for byte 0x%02x", b)
+		}
+		t.ByteIDs[b] = id
+	}
+	for tok, id := range vocab {
+		if id < 0 {
+			return nil, fmt.Errorf("token %q has negative id %d", tok, id)
+		}
+		t.Decoder[id] = tok
+		t.Encoder[tok] = id
+		t.Size = max(t.Size, id+1)
+	}
+	return &importer{t: t, vocab: vocab}, nil
+}
+
+// merge adds the rule a+b with rank. The merged token must be in the vocabulary.
+func (im *importer) merge(a, b string, rank int) error {
+	ida, okA := im.vocab[a]
+	idb, okB := im.vocab[b]
+	id, ok := im.vocab[a+b]
+	if !okA || !okB || !ok {
+		return fmt.Errorf("merge %q %q: token not in vocabulary", a, b)
+	}
+	key := fmt.Sprintf("%d,%d", ida, idb)
+	if _, dup := im.t.Merges[key]; dup {
+		return nil // Repeated; the first (lowest ranked) one wins
+	}
+	im.t.Merges[key] = rank
+	if id != rank {
+		im.t.MergeIDs[key] = id
+	}
+	return nil
+}
+
+// special registers tok under its original id.
+func (im *importer) special(tok string, id int) {
+	if im.t.Special == nil {
+		im.t.Special = make(map[string]int)
+	}
+	im.t.Special[tok] = id
+	im.t.Decoder[id] = tok
+	im.t.Encoder[tok] = id
+	im.t.Size = max(im.t.Size, id+1)
+}
+
+func (im *importer) finish(pattern string) (*BPE, error) {
+	if err := im.t.SetPattern(pattern); err != nil {
+		return nil, err
+	}
+	if len(im.t.MergeIDs) == 0 {
+		im.t.MergeIDs = nil
+	}
+	return im.t, nil
+}
+
+// LoadGPT2 reads GPT-2's encoder.json (token -> id) and vocab.bpe (merges in
+// rank order). <|endoftext|> becomes a special token and text is split with
+// GPT2Pattern.
+func LoadGPT2(encoderPath, vocabPath string) (*BPE, error) {
+	data, err := os.ReadFile(encoderPath)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]int
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", encoderPath, err)
+	}
+	alphabet := byteLevelAlphabet()
+	vocab := make(map[string]int, len(raw))
+	eot, hasEOT := raw[EndOfText]
+	for tok, id := range raw {
+		if tok == EndOfText {
+			continue
+		}
+		b, err := decodeByteLevel(alphabet, tok)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", encoderPath, err)
+		}
+		vocab[b] = id
+	}
+	im, err := newImporter(vocab)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", encoderPath, err)
+	}
+	if hasEOT {
+		im.special(EndOfText, eot)
+	}
+
+	data, err = os.ReadFile(vocabPath)
+	if err != nil {
+		return nil, err
+	}
+	rank := 0
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" || i == 0 && strings.HasPrefix(line, "#version") {
+			continue
+		}
+		if err := im.mergeByteLevel(alphabet, line, rank); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", vocabPath, i+1, err)
+		}
+		rank++
+	}
+	return im.finish(GPT2Pattern)
+}
+
+// mergeByteLevel adds a merge written as "a b" in the byte-level alphabet.
+func (im *importer) mergeByteLevel(alphabet map[rune]byte, line string, rank int) error {
+	as, bs, ok := strings.Cut(line, " ")
+	if !ok {
+		return fmt.Errorf("malformed merge %q", line)
+	}
+	a, err := decodeByteLevel(alphabet, as)
+	if err != nil {
+		return err
+	}
+	b, err := decodeByteLevel(alphabet, bs)
+	if err != nil {
+		return err
+	}
+	return im.merge(a, b, rank)
+}
+
+// LoadTiktoken reads a tiktoken rank file (one base64 token and its rank per
+// line). Ranks are the token ids. tiktoken merges any two adjacent parts
+// that form a token, lowest rank first, so every split of a token into two
+// tokens becomes a merge with the rank of the whole. The file holds neither
+// the split pattern nor the special tokens; pass those from the encoding's
+// definition.
+func LoadTiktoken(path, pattern string, special map[string]int) (*BPE, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	vocab := make(map[string]int)
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		fields := bytes.Fields(sc.Bytes())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: want a token and a rank", path, line)
+		}
+		tok, err := base64.StdEncoding.DecodeString(string(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		rank, err := strconv.Atoi(string(fields[1]))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: bad rank %q", path, line, fields[1])
+		}
+		vocab[string(tok)] = rank
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	im, err := newImporter(vocab)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for tok, rank := range vocab {
+		for k := 1; k < len(tok); k++ {
+			_, okA := vocab[tok[:k]]
+			_, okB := vocab[tok[k:]]
+			if okA && okB {
+				im.merge(tok[:k], tok[k:], rank)
+			}
+		}
+	}
+	for tok, id := range special {
+		im.special(tok, id)
+	}
+	return im.finish(pattern)
+}
+
+// Encodings that Import recognizes by the name of their .tiktoken file.
+var tiktokenEncodings = map[string]struct {
+	pattern string
+	special map[string]int
+}{
+	"gpt2":      {GPT2Pattern, map[string]int{EndOfText: 50256}},
+	"r50k_base": {GPT2Pattern, map[string]int{EndOfText: 50256}},
+	"p50k_base": {GPT2Pattern, map[string]int{EndOfText: 50256}},
+	"cl100k_base": {CL100KPattern, map[string]int{
+		EndOfText:         100257,
+		"<|fim_prefix|>":  100258,
+		"<|fim_middle|>":  100259,
+		"<|fim_suffix|>":  100260,
+		"<|endofprompt|>": 100276,
+	}},
+}
+
+// hfTokenizer is the part of a Hugging Face tokenizer.json that LoadHuggingFace reads.
+type hfTokenizer struct {
+	AddedTokens []struct {
+		ID      int    `json:"id"`
+		Content string `json:"content"`
+	} `json:"added_tokens"`
+	PreTokenizer *hfPreTokenizer `json:"pre_tokenizer"`
+	Decoder      *struct {
+		Type string `json:"type"`
+	} `json:"decoder"`
+	Model *struct {
+		Type   string            `json:"type"`
+		Vocab  map[string]int    `json:"vocab"`
+		Merges []json.RawMessage `json:"merges"`
+	} `json:"model"`
+}
+
+type hfPreTokenizer struct {
+	Type           string `json:"type"`
+	AddPrefixSpace bool   `json:"add_prefix_space"`
+	UseRegex       *bool  `json:"use_regex"`
+	Pattern        *struct {
+		Regex string `json:"Regex"`
+	} `json:"pattern"`
+	PreTokenizers []*hfPreTokenizer `json:"pretokenizers"`
+}
+
+// pattern returns the split pattern p applies and whether it is byte-level.
+func (p *hfPreTokenizer) pattern() (pattern string, byteLevel bool, err error) {
+	if p == nil {
+		return "", false, nil
+	}
+	switch p.Type {
+	case "ByteLevel":
+		if p.AddPrefixSpace {
+			return "", false, fmt.Errorf("add_prefix_space is not supported")
+		}
+		if p.UseRegex == nil || *p.UseRegex {
+			pattern = GPT2Pattern
+		}
+		return pattern, true, nil
+	case "Split":
+		if p.Pattern == nil || p.Pattern.Regex == "" {
+			return "", false, fmt.Errorf("only regex Split pre-tokenizers are supported")
+		}
+		return p.Pattern.Regex, false, nil
+	case "Sequence":
+		for _, sub := range p.PreTokenizers {
+			pat, bl, err := sub.pattern()
+			if err != nil {
+				return "", false, err
+			}
+			if pat != "" {
+				if pattern != "" {
+					return "", false, fmt.Errorf("more than one split pattern")
+				}
+				pattern = pat
+			}
+			byteLevel = byteLevel || bl
+		}
+		return pattern, byteLevel, nil
+	}
+	return "", false, fmt.Errorf("unsupported pre-tokenizer %q", p.Type)
+}
+
+// LoadHuggingFace reads a Hugging Face tokenizer.json with a byte-level BPE
+// model. Added tokens become special tokens, and a regex pre-tokenizer
+// becomes the split pattern.
+func LoadHuggingFace(path string) (*BPE, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var hf hfTokenizer
+	if err := json.Unmarshal(data, &hf); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if hf.Model == nil || hf.Model.Type != "BPE" && hf.Model.Type != "" {
+		return nil, fmt.Errorf("%s: only BPE models are supported", path)
+	}
+	pattern, byteLevel, err := hf.PreTokenizer.pattern()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if !byteLevel && (hf.Decoder == nil || hf.Decoder.Type != "ByteLevel") {
+		return nil, fmt.Errorf("%s: only byte-level BPE is supported", path)
+	}
+
+	added := make(map[int]bool, len(hf.AddedTokens))
+	for _, at := range hf.AddedTokens {
+		added[at.ID] = true
+	}
+	alphabet := byteLevelAlphabet()
+	vocab := make(map[string]int, len(hf.Model.Vocab))
+	for tok, id := range hf.Model.Vocab {
+		if added[id] {
+			continue
+		}
+		b, err := decodeByteLevel(alphabet, tok)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		vocab[b] = id
+	}
+	im, err := newImporter(vocab)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, at := range hf.AddedTokens {
+		im.special(at.Content, at.ID)
+	}
+
+	for rank, raw := range hf.Model.Merges {
+		// Merges are either "a b" or, in newer files, ["a", "b"]
+		var line string
+		if err := json.Unmarshal(raw, &line); err != nil {
+			var pair []string
+			if err := json.Unmarshal(raw, &pair); err != nil || len(pair) != 2 {
+				return nil, fmt.Errorf("%s: malformed merge %s", path, raw)
+			}
+			line = pair[0] + " " + pair[1]
+		}
+		if err := im.mergeByteLevel(alphabet, line, rank); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return im.finish(pattern)
+}
+
+// Import loads a tokenizer in any supported format, recognized by its path:
+//   - a directory holding encoder.json and vocab.bpe (GPT-2) or tokenizer.json
+//   - a <encoding>.tiktoken file of a known encoding (gpt2, r50k_base,
+//     p50k_base, cl100k_base)
+//   - a Hugging Face tokenizer.json
+//   - a tokenizer saved with Save (see Load)
+func Import(path string) (Tokenizer, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		enc, bpe := filepath.Join(path, "encoder.json"), filepath.Join(path, "vocab.bpe")
+		if fileExists(enc) && fileExists(bpe) {
+			return asTokenizer(LoadGPT2(enc, bpe))
+		}
+		if p := filepath.Join(path, "tokenizer.json"); fileExists(p) {
+			return Import(p)
+		}
+		return nil, fmt.Errorf("%s: no encoder.json and vocab.bpe or tokenizer.json", path)
+	}
+
+	if name, ok := strings.CutSuffix(filepath.Base(path), ".tiktoken"); ok {
+		e, ok := tiktokenEncodings[name]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown tiktoken encoding %q (use LoadTiktoken)", path, name)
+		}
+		return asTokenizer(LoadTiktoken(path, e.pattern, e.special))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var probe struct {
+		Model json.RawMessage `json:"model"`
+	}
+	if json.Unmarshal(data, &probe) == nil && probe.Model != nil {
+		return asTokenizer(LoadHuggingFace(path))
+	}
+	return Load(path)
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
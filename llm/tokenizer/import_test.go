@@ -0,0 +1,215 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// importSource is a trained tokenizer to export in foreign formats.
+func importSource(t *testing.T) *BPE {
+	tok := New()
+	if err := tok.SetPattern("gpt2"); err != nil {
+		t.Fatal(err)
+	}
+	tok.AddSpecial(EndOfText)
+	tok.Train(strings.Repeat("the cat sat on the mat. Ünïcödé café, naïve ↓↓!\n", 40), 400)
+	return tok
+}
+
+var importTexts = []string{
+	"",
+	"the cat sat on the mat",
+	"Ünïcödé café ↓ naïve\n\n  the  end ",
+	"unseen words: zebra quokka 12345 ☃",
+}
+
+// byteLevel writes bytes in GPT-2's byte-level alphabet.
+func byteLevel(s string) string {
+	enc := make(map[byte]rune, 256)
+	for r, b := range byteLevelAlphabet() {
+		enc[b] = r
+	}
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		sb.WriteRune(enc[s[i]])
+	}
+	return sb.String()
+}
+
+// mergesByRank returns the token pairs of src's merges in rank order.
+func mergesByRank(src *BPE) [][2]string {
+	var out [][2]string
+	for _, r := range src.mergeRules() {
+		out = append(out, [2]string{src.Decoder[r.a], src.Decoder[r.b]})
+	}
+	return out
+}
+
+func writeJSON(t *testing.T, path string, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportGPT2AndHuggingFace(t *testing.T) {
+	src := importSource(t)
+	eot, _ := src.SpecialID(EndOfText)
+	// Foreign files number tokens differently: reverse the ordinary ids
+	remap := func(id int) int {
+		if id == eot {
+			return id
+		}
+		return eot - 1 - id
+	}
+	vocab := make(map[string]int)
+	for id, tok := range src.Decoder {
+		if id != eot {
+			vocab[byteLevel(tok)] = remap(id)
+		}
+	}
+
+	// GPT-2: encoder.json and vocab.bpe
+	dir := t.TempDir()
+	gptVocab := map[string]int{EndOfText: eot}
+	for tok, id := range vocab {
+		gptVocab[tok] = id
+	}
+	writeJSON(t, filepath.Join(dir, "encoder.json"), gptVocab)
+	lines := []string{"#version: 0.2"}
+	var hfMerges []any
+	for i, m := range mergesByRank(src) {
+		lines = append(lines, byteLevel(m[0])+" "+byteLevel(m[1]))
+		if i%2 == 0 {
+			hfMerges = append(hfMerges, byteLevel(m[0])+" "+byteLevel(m[1]))
+		} else {
+			hfMerges = append(hfMerges, []string{byteLevel(m[0]), byteLevel(m[1])})
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "vocab.bpe"), []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hugging Face: tokenizer.json, merges in both the old and new format
+	hfPath := filepath.Join(t.TempDir(), "tokenizer.json")
+	writeJSON(t, hfPath, map[string]any{
+		"added_tokens":  []any{map[string]any{"id": eot, "content": EndOfText, "special": true}},
+		"pre_tokenizer": map[string]any{"type": "ByteLevel", "add_prefix_space": false, "use_regex": true},
+		"decoder":       map[string]any{"type": "ByteLevel"},
+		"model":         map[string]any{"type": "BPE", "vocab": vocab, "merges": hfMerges},
+	})
+
+	for _, path := range []string{dir, hfPath} {
+		tok, err := Import(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok.VocabSize() != src.Size {
+			t.Fatalf("%s: VocabSize %d, want %d", path, tok.VocabSize(), src.Size)
+		}
+
+		// Encoding must survive Save and Load too
+		saved := filepath.Join(t.TempDir(), "saved.json")
+		if err := tok.Save(saved); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := Load(saved)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, text := range importTexts {
+			text += EndOfText + text
+			want, _ := src.EncodeWithPolicy(text, SpecialPolicy{AllowAll: true})
+			for i := range want {
+				want[i] = remap(want[i])
+			}
+			for _, tk := range []Tokenizer{tok, loaded} {
+				got, err := tk.EncodeWithPolicy(text, SpecialPolicy{AllowAll: true})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !sameIDs(got, want) {
+					t.Fatalf("%s: Encode(%.20q) = %v, want %v", path, text, got, want)
+				}
+				if tk.Decode(got) != text {
+					t.Fatalf("%s: round trip changed %.20q", path, text)
+				}
+			}
+		}
+	}
+}
+
+// naiveTiktoken is tiktoken's algorithm: merge the adjacent pair whose
+// concatenation has the lowest rank, leftmost first.
+func naiveTiktoken(ranks map[string]int, piece string) []int {
+	var parts []string
+	for i := 0; i < len(piece); i++ {
+		parts = append(parts, piece[i:i+1])
+	}
+	for {
+		best, bestRank := -1, 0
+		for i := 0; i+1 < len(parts); i++ {
+			if r, ok := ranks[parts[i]+parts[i+1]]; ok && (best < 0 || r < bestRank) {
+				best, bestRank = i, r
+			}
+		}
+		if best < 0 {
+			break
+		}
+		parts[best] += parts[best+1]
+		parts = append(parts[:best+1], parts[best+2:]...)
+	}
+	ids := make([]int, len(parts))
+	for i, p := range parts {
+		ids[i] = ranks[p]
+	}
+	return ids
+}
+
+func TestImportTiktoken(t *testing.T) {
+	src := importSource(t)
+	eot, _ := src.SpecialID(EndOfText)
+
+	ranks := make(map[string]int)
+	var sb strings.Builder
+	for id, tok := range src.Decoder {
+		if id != eot {
+			ranks[tok] = id
+			fmt.Fprintf(&sb, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(tok)), id)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "test.tiktoken")
+	if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tok, err := LoadTiktoken(path, GPT2Pattern, map[string]int{EndOfText: eot})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Import(path); err == nil {
+		t.Error("Import accepted an unknown tiktoken encoding")
+	}
+
+	for _, text := range importTexts {
+		var want []int
+		for _, piece := range tok.Pretokenize(text) {
+			want = append(want, naiveTiktoken(ranks, piece)...)
+		}
+		if got := tok.Encode(text); !sameIDs(got, want) {
+			t.Fatalf("Encode(%.20q) = %v, want %v", text, got, want)
+		}
+	}
+	if got, _ := tok.EncodeWithPolicy(EndOfText, SpecialPolicy{AllowAll: true}); !sameIDs(got, []int{eot}) {
+		t.Fatalf("special token encoded as %v", got)
+	}
+}
@@ -0,0 +1,130 @@
+package tokenizer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Split patterns. Text is cut into pieces with the pattern before BPE runs,
+// so merges never cross a piece boundary (e.g. between a word and the
+// whitespace or punctuation around it).
+const (
+	// GPT2Pattern is the pre-tokenization pattern of GPT-2.
+	GPT2Pattern = `'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`
+
+	// CL100KPattern is the pre-tokenization pattern of cl100k_base (GPT-4).
+	CL100KPattern = `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`
+)
+
+// patternPresets maps the names accepted by SetPattern to their patterns.
+var patternPresets = map[string]string{
+	"gpt2":   GPT2Pattern,
+	"cl100k": CL100KPattern,
+}
+
+// wsTail ends both presets. Go regexps have no lookahead, so the splitter
+// handles these alternatives itself: a whitespace run followed by more text
+// leaves its last character to start the next piece.
+const wsTail = `|\s+(?!\S)|\s+`
+
+// splitter cuts text into pre-tokenization pieces.
+type splitter struct {
+	re          *regexp.Regexp // Pattern anchored at the start of the remaining text
+	wsLookahead bool           // Pattern ended in wsTail
+}
+
+// resolvePattern expands a preset name; anything else is taken as a regexp.
+func resolvePattern(pattern string) string {
+	if p, ok := patternPresets[pattern]; ok {
+		return p
+	}
+	return pattern
+}
+
+func newSplitter(pattern string) (*splitter, error) {
+	body, ws := strings.CutSuffix(pattern, wsTail)
+	re, err := regexp.Compile(`\A(?:` + body + `)`)
+	if err != nil {
+		return nil, fmt.Errorf("invalid split pattern: %w", err)
+	}
+	return &splitter{re: re, wsLookahead: ws}, nil
+}
+
+// splitWindow bounds the text handed to the regexp. On short inputs Go's
+// regexp can use its much faster backtracking matcher.
+const splitWindow = 256
+
+// next returns the length of the piece starting at text[0].
+func (s *splitter) next(text string) int {
+	window := text
+	if len(window) > splitWindow {
+		window = window[:splitWindow]
+	}
+	loc := s.re.FindStringIndex(window)
+	if len(window) < len(text) && (loc == nil || loc[1] == len(window)) {
+		// The piece may continue past the window, or only match with the
+		// rest of the text (e.g. \s*[\r\n]+ after a long run of spaces)
+		loc = s.re.FindStringIndex(text)
+	}
+	if loc != nil && loc[1] > 0 {
+		return loc[1]
+	}
+	if s.wsLookahead {
+		n := 0
+		for n < len(text) && isSpace(text[n]) {
+			n++
+		}
+		if n > 0 {
+			// \s+(?!\S): stop before the last space if text follows
+			if n > 1 && n < len(text) {
+				n--
+			}
+			return n
+		}
+	}
+	// Not covered by the pattern: a piece of its own
+	_, size := utf8.DecodeRuneInString(text)
+	return size
+}
+
+// split returns the pieces of text in order.
+func (s *splitter) split(text string) []string {
+	var pieces []string
+	for len(text) > 0 {
+		n := s.next(text)
+		pieces = append(pieces, text[:n])
+		text = text[n:]
+	}
+	return pieces
+}
+
+// isSpace matches \s in Go regexps.
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\f' || b == '\r'
+}
+
+// SetPattern enables pre-tokenization with pattern, which is either a preset
+// name ("gpt2", "cl100k") or a regexp. An empty pattern runs BPE over the
+// raw bytes. Set it before Train; the pattern is saved with the tokenizer.
+func (t *BPE) SetPattern(pattern string) error {
+	pattern = resolvePattern(pattern)
+	if pattern != "" {
+		if _, err := newSplitter(pattern); err != nil {
+			return err
+		}
+	}
+	t.Pattern = pattern
+	t.invalidate()
+	return nil
+}
+
+// Pretokenize returns the pieces Train and Encode see for text. Without a
+// pattern that is the whole text.
+func (t *BPE) Pretokenize(text string) []string {
+	if s := t.encoder().split; s != nil {
+		return s.split(text)
+	}
+	return []string{text}
+}
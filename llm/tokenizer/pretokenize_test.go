@@ -0,0 +1,90 @@
+package tokenizer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPretokenizePresets(t *testing.T) {
+	cases := []struct {
+		pattern string
+		text    string
+		want    []string
+	}{
+		{"gpt2", "Hello world's  test\n\nfoo 123 end  ",
+			[]string{"Hello", " world", "'s", " ", " test", "\n", "\n", "foo", " 123", " end", "  "}},
+		{"cl100k", "Hello world 12345\n\n  x",
+			[]string{"Hello", " world", " ", "123", "45", "\n\n", " ", " x"}},
+		// Longer than the regexp window
+		{"cl100k", strings.Repeat(" ", 300) + "\nx",
+			[]string{strings.Repeat(" ", 300) + "\n", "x"}},
+		{"gpt2", strings.Repeat("a", 300) + " b",
+			[]string{strings.Repeat("a", 300), " b"}},
+	}
+	for _, c := range cases {
+		tok := New()
+		if err := tok.SetPattern(c.pattern); err != nil {
+			t.Fatal(err)
+		}
+		if got := tok.Pretokenize(c.text); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %q, want %q", c.pattern, got, c.want)
+		}
+	}
+
+	if err := New().SetPattern(`(unclosed`); err == nil {
+		t.Error("expected an error for an invalid pattern")
+	}
+}
+
+func TestPatternTrainAndReload(t *testing.T) {
+	text := strings.Repeat("the cat sat on the mat. Ünïcödé café, naïve!\n", 50)
+
+	tok := New()
+	if err := tok.SetPattern("gpt2"); err != nil {
+		t.Fatal(err)
+	}
+	tok.Train(text, 400)
+
+	// No merge may cross a piece boundary, e.g. "e t" or "t."
+	pieces := tok.Pretokenize(text)
+	for id := 256; id < tok.Size; id++ {
+		inPiece := false
+		for _, p := range pieces {
+			if strings.Contains(p, tok.Decoder[id]) {
+				inPiece = true
+				break
+			}
+		}
+		if !inPiece {
+			t.Fatalf("token %d %q spans a piece boundary", id, tok.Decoder[id])
+		}
+	}
+
+	path := t.TempDir() + "/tokenizer.json"
+	if err := tok.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadBPE(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Pattern != GPT2Pattern {
+		t.Fatalf("pattern not restored: %q", loaded.Pattern)
+	}
+
+	ids := tok.Encode(text)
+	if got := loaded.Encode(text); !sameIDs(got, ids) {
+		t.Fatal("Encode differs after Load")
+	}
+	if got := loaded.Decode(ids); got != text {
+		t.Fatalf("Decode after Load = %.40q", got)
+	}
+	streamed, err := loaded.EncodeReader(strings.NewReader(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameIDs(streamed, ids) {
+		t.Fatal("EncodeReader differs from Encode")
+	}
+}
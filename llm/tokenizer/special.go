@@ -0,0 +1,212 @@
+package tokenizer
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// EndOfText is the special token that separates documents.
+const EndOfText = "<|endoftext|>"
+
+// ErrDisallowedSpecial is returned (wrapped) when text contains a special
+// token that the SpecialPolicy denies.
+var ErrDisallowedSpecial = errors.New("text contains a disallowed special token")
+
+// SpecialPolicy says how special tokens found in text are encoded. A token
+// that is neither allowed nor denied is encoded as ordinary text.
+type SpecialPolicy struct {
+	Allow    []string // Encoded as their special id
+	AllowAll bool     // Every registered special token is allowed
+	Deny     []string // Encoding fails if one of these occurs
+	DenyAll  bool     // Every special token that is not allowed is denied
+}
+
+// AddSpecial registers special tokens that are never produced or split by
+// BPE. Each new token gets the next free id; already registered tokens keep
+// theirs. Train renumbers them to follow the learned merges.
+func (t *BPE) AddSpecial(tokens ...string) {
+	if t.Special == nil {
+		t.Special = make(map[string]int)
+	}
+	for _, tok := range tokens {
+		if _, ok := t.Special[tok]; ok || tok == "" {
+			continue
+		}
+		id := t.Size
+		t.Special[tok] = id
+		t.Decoder[id] = tok
+		t.Encoder[tok] = id
+		t.Size++
+	}
+	t.invalidate()
+}
+
+// SpecialID returns the id of a registered special token.
+func (t *BPE) SpecialID(tok string) (int, bool) {
+	id, ok := t.Special[tok]
+	return id, ok
+}
+
+// IsSpecial reports whether id is a special token.
+func (t *BPE) IsSpecial(id int) bool {
+	_, ok := specialToken(t.Special, id)
+	return ok
+}
+
+// specialSet returns every token of special as a set.
+func specialSet(special map[string]int) map[string]bool {
+	set := make(map[string]bool, len(special))
+	for tok := range special {
+		set[tok] = true
+	}
+	return set
+}
+
+// specialTokens returns the tokens of special ordered by id.
+func specialTokens(special map[string]int) []string {
+	toks := make([]string, 0, len(special))
+	for tok := range special {
+		toks = append(toks, tok)
+	}
+	sort.Slice(toks, func(i, j int) bool { return special[toks[i]] < special[toks[j]] })
+	return toks
+}
+
+// specialToken looks up the special token with the given id.
+func specialToken(special map[string]int, id int) (string, bool) {
+	for tok, sid := range special {
+		if sid == id {
+			return tok, true
+		}
+	}
+	return "", false
+}
+
+// addSpecial registers the new tokens in special with ids from next on and
+// returns the (possibly allocated) map.
+func addSpecial(special map[string]int, next int, tokens []string) map[string]int {
+	if special == nil {
+		special = make(map[string]int)
+	}
+	for _, tok := range tokens {
+		if _, ok := special[tok]; ok || tok == "" {
+			continue
+		}
+		special[tok] = next
+		next++
+	}
+	return special
+}
+
+// renumberSpecial moves special ids to follow the merges, keeping their order.
+func (t *BPE) renumberSpecial() {
+	for i, tok := range specialTokens(t.Special) {
+		if old := t.Special[tok]; t.Decoder[old] == tok {
+			delete(t.Decoder, old) // Unless a merge took the id over
+		}
+		id := 256 + len(t.Merges) + i
+		t.Special[tok] = id
+		t.Decoder[id] = tok
+		t.Encoder[tok] = id
+	}
+}
+
+// EncodeWithPolicy is Encode with special tokens handled according to p.
+// Allowed special tokens become their id and split the text around them, so
+// BPE never merges across one.
+func (t *BPE) EncodeWithPolicy(text string, p SpecialPolicy) ([]int, error) {
+	return encodeWithPolicy(t.Special, t.Encode, text, p)
+}
+
+// encodeWithPolicy implements EncodeWithPolicy for any tokenizer with the
+// given special tokens and plain-text encoder.
+func encodeWithPolicy(special map[string]int, encode func(string) []int, text string, p SpecialPolicy) ([]int, error) {
+	allowed := make(map[string]bool)
+	for _, tok := range p.Allow {
+		if _, ok := special[tok]; !ok {
+			return nil, fmt.Errorf("%q is not a registered special token", tok)
+		}
+		allowed[tok] = true
+	}
+	if p.AllowAll {
+		for tok := range special {
+			allowed[tok] = true
+		}
+	}
+
+	denied := p.Deny
+	if p.DenyAll {
+		denied = denied[:0:0]
+		for tok := range special {
+			if !allowed[tok] {
+				denied = append(denied, tok)
+			}
+		}
+	}
+	for _, tok := range denied {
+		if !allowed[tok] && strings.Contains(text, tok) {
+			return nil, fmt.Errorf("%w: %q", ErrDisallowedSpecial, tok)
+		}
+	}
+
+	var out []int
+	for _, span := range splitSpecial(text, allowed) {
+		if id, ok := special[span]; ok && allowed[span] {
+			out = append(out, id)
+			continue
+		}
+		out = append(out, encode(span)...)
+	}
+	return out, nil
+}
+
+// splitSpecial cuts text into ordinary spans and occurrences of the tokens
+// in special, in order. At equal positions the longest token wins.
+func splitSpecial(text string, special map[string]bool) []string {
+	if len(special) == 0 {
+		return []string{text}
+	}
+
+	// Next occurrence of each token at or after pos, -1 if none
+	next := make(map[string]int, len(special))
+	find := func(tok string, pos int) {
+		if i := strings.Index(text[pos:], tok); i >= 0 {
+			next[tok] = pos + i
+		} else {
+			next[tok] = -1
+		}
+	}
+	for tok := range special {
+		find(tok, 0)
+	}
+
+	var spans []string
+	pos := 0
+	for pos < len(text) {
+		start, match := -1, ""
+		for tok, i := range next {
+			if i >= 0 && i < pos {
+				find(tok, pos) // Overlapped the previous match
+				i = next[tok]
+			}
+			if i < 0 {
+				continue
+			}
+			if start < 0 || i < start || i == start && len(tok) > len(match) {
+				start, match = i, tok
+			}
+		}
+		if start < 0 {
+			spans = append(spans, text[pos:])
+			break
+		}
+		if start > pos {
+			spans = append(spans, text[pos:start])
+		}
+		spans = append(spans, match)
+		pos = start + len(match)
+	}
+	return spans
+}
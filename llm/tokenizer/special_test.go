@@ -0,0 +1,89 @@
+package tokenizer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSpecialTokens(t *testing.T) {
+	tok := New()
+	tok.AddSpecial(EndOfText, "<|user|>")
+	tok.Train(strings.Repeat("hello world"+EndOfText+"goodbye moon"+EndOfText, 30), 300)
+
+	eot, ok := tok.SpecialID(EndOfText)
+	if !ok || eot != 256+len(tok.Merges) {
+		t.Fatalf("EndOfText id %d, want %d", eot, 256+len(tok.Merges))
+	}
+	user, _ := tok.SpecialID("<|user|>")
+	if user != eot+1 || tok.Size > 300 || tok.Size != user+1 {
+		t.Fatalf("special ids %d, %d with vocab size %d", eot, user, tok.Size)
+	}
+
+	// Merges never cross a special token or contain its text
+	for id := 256; id < eot; id++ {
+		if s := tok.Decoder[id]; strings.Contains(s, "<|") || strings.Contains(s, "|>") {
+			t.Fatalf("merged token %q overlaps a special token", s)
+		}
+	}
+
+	text := "hello world" + EndOfText + "<|user|>goodbye"
+
+	// Plain Encode treats special tokens as text
+	for _, id := range tok.Encode(text) {
+		if tok.IsSpecial(id) {
+			t.Fatalf("Encode produced special id %d", id)
+		}
+	}
+
+	ids, err := tok.EncodeWithPolicy(text, SpecialPolicy{Allow: []string{EndOfText}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if countID(ids, eot) != 1 || countID(ids, user) != 0 {
+		t.Fatalf("Allow EndOfText: got %v", ids)
+	}
+	if got := tok.Decode(ids); got != text {
+		t.Fatalf("Decode = %q, want %q", got, text)
+	}
+
+	ids, err = tok.EncodeWithPolicy(text, SpecialPolicy{AllowAll: true})
+	if err != nil || countID(ids, eot) != 1 || countID(ids, user) != 1 {
+		t.Fatalf("AllowAll: got %v, %v", ids, err)
+	}
+
+	_, err = tok.EncodeWithPolicy(text, SpecialPolicy{Allow: []string{EndOfText}, DenyAll: true})
+	if !errors.Is(err, ErrDisallowedSpecial) {
+		t.Fatalf("DenyAll: expected ErrDisallowedSpecial, got %v", err)
+	}
+	if _, err := tok.EncodeWithPolicy(text, SpecialPolicy{Allow: []string{"<|nope|>"}}); err == nil {
+		t.Fatal("expected an error for an unregistered special token")
+	}
+
+	docs := EncodeDocuments(tok, []string{"hello", "world", "moon"})
+	if countID(docs, eot) != 2 {
+		t.Fatalf("EncodeDocuments: got %v", docs)
+	}
+
+	path := t.TempDir() + "/tokenizer.json"
+	if err := tok.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadBPE(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := loaded.SpecialID(EndOfText); id != eot || loaded.Decoder[eot] != EndOfText {
+		t.Fatalf("special tokens not restored: %v", loaded.Special)
+	}
+}
+
+func countID(ids []int, id int) int {
+	n := 0
+	for _, v := range ids {
+		if v == id {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,66 @@
+package tokenizer
+
+import (
+	"errors"
+	"unicode/utf8"
+)
+
+// ErrIncompleteUTF8 is returned by StreamDecoder.Flush when the stream ended
+// in the middle of a UTF-8 character.
+var ErrIncompleteUTF8 = errors.New("token stream ends inside a UTF-8 character")
+
+// StreamDecoder turns ids into text one token at a time. Byte-level tokens
+// (BPE, Unigram's byte fallback) can split a multi-byte character; the
+// decoder holds such bytes back until the character is complete, so
+// everything it returns is valid UTF-8. Bytes that can never form a
+// character become U+FFFD.
+type StreamDecoder struct {
+	t       Tokenizer
+	pending []byte // Start of an incomplete character
+}
+
+// NewStreamDecoder returns a decoder for ids of t.
+func NewStreamDecoder(t Tokenizer) *StreamDecoder {
+	return &StreamDecoder{t: t}
+}
+
+// Write adds the token id and returns the text completed by it, which may be
+// empty. Unknown ids decode to nothing, like Decode.
+func (d *StreamDecoder) Write(id int) string {
+	tok, _ := d.t.Token(id)
+	d.pending = append(d.pending, tok...)
+
+	var out []byte
+	buf := d.pending
+	for len(buf) > 0 {
+		r, size := utf8.DecodeRune(buf)
+		if r == utf8.RuneError && size <= 1 {
+			if !utf8.FullRune(buf) {
+				break // May still be completed by the next token
+			}
+			out = utf8.AppendRune(out, utf8.RuneError)
+			buf = buf[1:]
+			continue
+		}
+		out = append(out, buf[:size]...)
+		buf = buf[size:]
+	}
+	d.pending = append(d.pending[:0], buf...)
+	return string(out)
+}
+
+// Pending reports whether bytes of an incomplete character are held back.
+func (d *StreamDecoder) Pending() bool {
+	return len(d.pending) > 0
+}
+
+// Flush ends the stream. Held-back bytes of an incomplete character are
+// returned as U+FFFD together with ErrIncompleteUTF8; the decoder is then
+// empty and can be reused.
+func (d *StreamDecoder) Flush() (string, error) {
+	if len(d.pending) == 0 {
+		return "", nil
+	}
+	d.pending = d.pending[:0]
+	return string(utf8.RuneError), ErrIncompleteUTF8
+}
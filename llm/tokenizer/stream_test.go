@@ -0,0 +1,55 @@
+package tokenizer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestStreamDecoder(t *testing.T) {
+	text := "naïve café ↓↓ 日本語 ☃ done"
+	tok := New()
+	tok.Train(strings.Repeat(text, 5), 300)
+
+	// Single bytes split every multi-byte character; merged tokens split some
+	var byteIDs []int
+	for i := 0; i < len(text); i++ {
+		byteIDs = append(byteIDs, int(text[i]))
+	}
+	for name, ids := range map[string][]int{"bytes": byteIDs, "merged": tok.Encode(text)} {
+		d := NewStreamDecoder(tok)
+		var sb strings.Builder
+		for _, id := range ids {
+			s := d.Write(id)
+			if !utf8.ValidString(s) {
+				t.Fatalf("%s: emitted invalid UTF-8 %q", name, s)
+			}
+			sb.WriteString(s)
+		}
+		if rest, err := d.Flush(); rest != "" || err != nil {
+			t.Fatalf("%s: Flush = %q, %v", name, rest, err)
+		}
+		if sb.String() != text {
+			t.Fatalf("%s: got %q, want %q", name, sb.String(), text)
+		}
+	}
+
+	// A character cut short by the next token
+	d := NewStreamDecoder(tok)
+	if got := d.Write(0xE2) + d.Write('a'); got != "�a" {
+		t.Errorf("broken character decoded as %q", got)
+	}
+
+	// A character cut short by the end of the stream
+	if got := d.Write(0xE2) + d.Write(0x86); got != "" || !d.Pending() {
+		t.Fatalf("incomplete character emitted %q", got)
+	}
+	rest, err := d.Flush()
+	if rest != "�" || !errors.Is(err, ErrIncompleteUTF8) {
+		t.Errorf("Flush = %q, %v", rest, err)
+	}
+	if d.Pending() {
+		t.Error("Flush left bytes pending")
+	}
+}
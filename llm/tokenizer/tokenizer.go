@@ -0,0 +1,158 @@
+package tokenizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Tokenizer converts between text and token ids. BPE, Char, Word and
+// Unigram implement it; NewOfType creates one by name and Load reads any of them
+// back, whatever type was saved.
+type Tokenizer interface {
+	// Type is the name NewOfType and Load know the tokenizer by.
+	Type() string
+
+	// Train learns the vocabulary from text. vocabSize bounds the number
+	// of tokens, special tokens included.
+	Train(text string, vocabSize int)
+
+	// Encode converts text to ids. Special tokens in text are encoded as
+	// ordinary text; see EncodeWithPolicy.
+	Encode(text string) []int
+	EncodeWithPolicy(text string, p SpecialPolicy) ([]int, error)
+	Decode(ids []int) string
+	// Token returns the text (bytes, for byte-level tokens) of one id.
+	Token(id int) (string, bool)
+	// VocabSize is one more than the largest id.
+	VocabSize() int
+
+	// AddSpecial registers special tokens, which are never split or
+	// merged with text around them.
+	AddSpecial(tokens ...string)
+	SpecialID(tok string) (int, bool)
+
+	Save(path string) error
+}
+
+// Tokenizer types.
+const (
+	TypeBPE     = "bpe"
+	TypeChar    = "char"
+	TypeWord    = "word"
+	TypeUnigram = "unigram"
+)
+
+// Types lists the tokenizer types NewOfType accepts.
+func Types() []string {
+	return []string{TypeBPE, TypeChar, TypeWord, TypeUnigram}
+}
+
+// NewOfType returns an untrained tokenizer of the named type.
+func NewOfType(name string) (Tokenizer, error) {
+	switch name {
+	case TypeBPE:
+		return New(), nil
+	case TypeChar:
+		return NewChar(), nil
+	case TypeWord:
+		return NewWord(), nil
+	case TypeUnigram:
+		return NewUnigram(), nil
+	}
+	return nil, fmt.Errorf("unknown tokenizer type %q (available: %v)", name, Types())
+}
+
+// Load reads a tokenizer written by Save. The type is recorded in the file;
+// files without one are BPE tokenizers from before there were other types.
+func Load(path string) (Tokenizer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var probe struct{ Type string }
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	switch probe.Type {
+	case "", TypeBPE:
+		return asTokenizer(LoadBPE(path))
+	case TypeChar:
+		return asTokenizer(LoadChar(path))
+	case TypeWord:
+		return asTokenizer(LoadWord(path))
+	case TypeUnigram:
+		return asTokenizer(LoadUnigram(path))
+	}
+	return nil, fmt.Errorf("%s: unknown tokenizer type %q", path, probe.Type)
+}
+
+// asTokenizer converts the result of a typed loader, keeping a failed load
+// a nil interface.
+func asTokenizer[T Tokenizer](t T, err error) (Tokenizer, error) {
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// saveJSON writes v, a tokenizer embedded in a struct that adds its Type.
+func saveJSON(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// EncodeDocuments encodes each document as plain text and joins them with
+// EndOfText if it is registered. BPE tokenizers encode the documents in
+// parallel.
+func EncodeDocuments(tok Tokenizer, docs []string) []int {
+	var encoded [][]int
+	if b, ok := tok.(interface{ EncodeBatch([]string) [][]int }); ok {
+		encoded = b.EncodeBatch(docs)
+	} else {
+		for _, doc := range docs {
+			encoded = append(encoded, tok.Encode(doc))
+		}
+	}
+
+	eot, hasEOT := tok.SpecialID(EndOfText)
+	var out []int
+	for i, ids := range encoded {
+		if i > 0 && hasEOT {
+			out = append(out, eot)
+		}
+		out = append(out, ids...)
+	}
+	return out
+}
+
+// EncodeReader encodes everything read from r. BPE tokenizers stream the
+// input in parallel blocks; others read it whole.
+func EncodeReader(tok Tokenizer, r io.Reader) ([]int, error) {
+	var out []int
+	err := EncodeStream(tok, r, func(ids []int) error {
+		out = append(out, ids...)
+		return nil
+	})
+	return out, err
+}
+
+// EncodeStream encodes everything read from r and passes the ids to emit in
+// order. BPE tokenizers hold only a few blocks of input at a time; others
+// read it whole.
+func EncodeStream(tok Tokenizer, r io.Reader, emit func(ids []int) error) error {
+	if s, ok := tok.(interface {
+		EncodeStream(io.Reader, func([]int) error) error
+	}); ok {
+		return s.EncodeStream(r, emit)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return emit(tok.Encode(string(data)))
+}
@@ -0,0 +1,133 @@
+package tokenizer
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTokenizerTypes(t *testing.T) {
+	corpus := strings.Repeat("the cat sat on the mat. naïve café ↓\n", 30) + EndOfText + "the end"
+	texts := []string{"", "the cat", "mat. café ↓\n\nthe  sat", "the" + EndOfText + "cat"}
+
+	for _, typ := range Types() {
+		tok, err := NewOfType(typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tok.AddSpecial(EndOfText)
+		tok.Train(corpus, 300)
+		if tok.Type() != typ {
+			t.Errorf("%s: Type() = %q", typ, tok.Type())
+		}
+		if tok.VocabSize() > 300 {
+			t.Errorf("%s: VocabSize %d, want at most 300", typ, tok.VocabSize())
+		}
+		eot, ok := tok.SpecialID(EndOfText)
+		if !ok || eot != tok.VocabSize()-1 {
+			t.Errorf("%s: special token id %d (%v), want the last id %d", typ, eot, ok, tok.VocabSize()-1)
+		}
+
+		// Load must recognize the type from the file
+		path := filepath.Join(t.TempDir(), "tokenizer.json")
+		if err := tok.Save(path); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded.Type() != typ || loaded.VocabSize() != tok.VocabSize() {
+			t.Fatalf("%s: loaded %s with %d tokens", typ, loaded.Type(), loaded.VocabSize())
+		}
+
+		for _, text := range texts {
+			ids, err := tok.EncodeWithPolicy(text, SpecialPolicy{AllowAll: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(text, EndOfText) && countID(ids, eot) != 1 {
+				t.Errorf("%s: %q encoded as %v", typ, text, ids)
+			}
+			for _, id := range ids {
+				if _, ok := tok.Token(id); !ok || id >= tok.VocabSize() {
+					t.Fatalf("%s: id %d out of the vocabulary", typ, id)
+				}
+			}
+			if got := tok.Decode(ids); got != text {
+				t.Errorf("%s: round trip of %q gave %q", typ, text, got)
+			}
+			if got := loaded.Encode(text); !sameIDs(got, tok.Encode(text)) {
+				t.Errorf("%s: Encode(%q) differs after Load", typ, text)
+			}
+		}
+	}
+
+	if _, err := NewOfType("wordpiece"); err == nil {
+		t.Error("NewOfType accepted an unknown type")
+	}
+}
+
+func TestCharUnknown(t *testing.T) {
+	tok := NewChar()
+	tok.Train("aab", 10)
+	if got := tok.Encode("abz"); !sameIDs(got, []int{1, 2, 0}) {
+		t.Fatalf("Encode = %v", got)
+	}
+	if got := tok.Decode([]int{1, 2, 0}); got != "ab�" {
+		t.Fatalf("Decode = %q", got)
+	}
+
+	// Only the most frequent characters fit
+	tok.Train("aaabbc", 3)
+	if got := tok.Encode("abc"); !sameIDs(got, []int{1, 2, 0}) {
+		t.Fatalf("after a size-limited Train, Encode = %v", got)
+	}
+}
+
+func TestWord(t *testing.T) {
+	tok := NewWord()
+	tok.Train("the cat sat on the mat, the end", 100)
+
+	// Known words are single tokens with their leading space
+	ids := tok.Encode("the cat, the mat")
+	if len(ids) != 5 || tok.Decode(ids[1:2]) != " cat" {
+		t.Errorf("Encode = %v", ids)
+	}
+	// Unknown words are spelled out; unseen characters are unknown
+	if got := tok.Decode(tok.Encode(" mast")); got != " mast" {
+		t.Errorf("round trip of an unknown word gave %q", got)
+	}
+	if got := tok.Decode(tok.Encode("cat!")); got != "cat"+unknownChar {
+		t.Errorf("Decode = %q", got)
+	}
+
+	// Characters come first when the vocabulary is small
+	tok.Train(" aaa bbb aaa", 5)
+	if got := tok.Words; len(got) != 5 || got[4] != " aaa" {
+		t.Errorf("size-limited vocabulary %q", got)
+	}
+}
+
+func TestUnigram(t *testing.T) {
+	corpus := strings.Repeat("the quick brown fox jumps over the lazy dog. ", 50)
+	tok := NewUnigram()
+	tok.Train(corpus, 300)
+
+	// Frequent words become single pieces, with the space before them
+	ids := tok.Encode(" the lazy dog.")
+	if len(ids) != 3 || tok.Decode(ids[1:2]) != " lazy" {
+		t.Errorf("%q split into %d pieces", " the lazy dog.", len(ids))
+	}
+	for _, p := range tok.Pieces {
+		if strings.Contains(strings.TrimLeft(p, " "), " ") {
+			t.Errorf("piece %q has whitespace after text", p)
+		}
+	}
+
+	// Unseen characters fall back to bytes and still round-trip
+	text := "the 日本 fox \xff"
+	if got := tok.Decode(tok.Encode(text)); got != text {
+		t.Errorf("round trip of %q gave %q", text, got)
+	}
+}
@@ -0,0 +1,238 @@
+package tokenizer
+
+import (
+	"container/heap"
+	"fmt"
+	"slices"
+)
+
+// bpeTrainer learns merges without rescanning the corpus. Every symbol lives
+// in a doubly linked list over one flat array, pair counts are kept up to
+// date as merges rewrite their neighbours, and a heap always holds the most
+// frequent pair on top. Each pair also remembers where it occurs, so a merge
+// only visits its own occurrences.
+//
+// The input is a set of words with counts. Pairs never span two words.
+type bpeTrainer struct {
+	ids  []int32 // Symbol at each position, -1 once merged into its left neighbour
+	prev []int32 // Previous live position in the same word, or -1
+	next []int32 // Next live position in the same word, or -1
+	freq []int32 // Count of the word each position belongs to
+
+	pairs map[uint64]*pairStat
+	queue pairQueue
+	dirty []*pairStat // Pairs whose count changed since the last settle
+}
+
+type pairStat struct {
+	key   uint64
+	count int
+	pos   []int32 // Left positions of (possibly stale) occurrences
+	index int     // Position in queue, -1 if not queued
+	dirty bool
+}
+
+func pairKey(a, b int32) uint64 {
+	return uint64(uint32(a))<<32 | uint64(uint32(b))
+}
+
+func splitKey(k uint64) (int32, int32) {
+	return int32(uint32(k >> 32)), int32(uint32(k))
+}
+
+func newBPETrainer(words [][]byte, counts []int) *bpeTrainer {
+	n := 0
+	for _, w := range words {
+		n += len(w)
+	}
+	tr := &bpeTrainer{
+		ids:   make([]int32, n),
+		prev:  make([]int32, n),
+		next:  make([]int32, n),
+		freq:  make([]int32, n),
+		pairs: make(map[uint64]*pairStat),
+	}
+
+	i := int32(0)
+	for w, word := range words {
+		start := i
+		for _, b := range word {
+			tr.ids[i] = int32(b)
+			tr.prev[i] = i - 1
+			tr.next[i] = i + 1
+			tr.freq[i] = int32(counts[w])
+			i++
+		}
+		if i > start {
+			tr.prev[start] = -1
+			tr.next[i-1] = -1
+		}
+	}
+
+	for p := int32(0); p < int32(n); p++ {
+		if q := tr.next[p]; q >= 0 {
+			tr.add(pairKey(tr.ids[p], tr.ids[q]), int(tr.freq[p]), p)
+		}
+	}
+	tr.settle()
+	return tr
+}
+
+// add changes the count of pair k by delta and, for new occurrences, records
+// the left position pos. A changed pair leaves the queue until settle puts it
+// back, so a merge touching the same pair many times pays for one heap
+// removal and one push, and the heap stays valid throughout.
+func (tr *bpeTrainer) add(k uint64, delta int, pos int32) {
+	st := tr.pairs[k]
+	if st == nil {
+		st = &pairStat{key: k, index: -1}
+		tr.pairs[k] = st
+	}
+	if !st.dirty {
+		st.dirty = true
+		tr.dirty = append(tr.dirty, st)
+		if st.index >= 0 {
+			heap.Remove(&tr.queue, st.index)
+		}
+	}
+	st.count += delta
+	if delta > 0 && pos >= 0 {
+		st.pos = append(st.pos, pos)
+	}
+}
+
+// settle requeues every changed pair that still occurs.
+func (tr *bpeTrainer) settle() {
+	for _, st := range tr.dirty {
+		st.dirty = false
+		if st.count <= 0 {
+			// No live occurrences left, so every recorded position is stale
+			delete(tr.pairs, st.key)
+			continue
+		}
+		heap.Push(&tr.queue, st)
+	}
+	tr.dirty = tr.dirty[:0]
+}
+
+// best returns the most frequent pair. Ties go to the smallest (a, b), so
+// training is deterministic.
+func (tr *bpeTrainer) best() (*pairStat, bool) {
+	if len(tr.queue) == 0 {
+		return nil, false
+	}
+	return tr.queue[0], true
+}
+
+// merge replaces every occurrence of st's pair with id, left to right within
+// each word, and updates the neighbouring pair counts.
+func (tr *bpeTrainer) merge(st *pairStat, id int32) {
+	a, b := splitKey(st.key)
+	pos := st.pos
+	slices.Sort(pos)
+
+	for _, i := range pos {
+		// Skip occurrences already consumed by an earlier merge (e.g. the
+		// middle of "aaa" when merging (a, a)).
+		if tr.ids[i] != a {
+			continue
+		}
+		j := tr.next[i]
+		if j < 0 || tr.ids[j] != b {
+			continue
+		}
+		f := int(tr.freq[i])
+
+		tr.add(st.key, -f, -1)
+		if p := tr.prev[i]; p >= 0 {
+			tr.add(pairKey(tr.ids[p], a), -f, -1)
+			tr.add(pairKey(tr.ids[p], id), f, p)
+		}
+		n := tr.next[j]
+		if n >= 0 {
+			tr.add(pairKey(b, tr.ids[n]), -f, -1)
+			tr.add(pairKey(id, tr.ids[n]), f, i)
+			tr.prev[n] = i
+		}
+
+		tr.ids[i] = id
+		tr.next[i] = n
+		tr.ids[j] = -1
+	}
+	tr.settle()
+}
+
+// trainWords learns up to vocabSize-256 merges from words and records them
+// in t. Byte tokens 0..255 are always present; special tokens follow the
+// merges.
+func (t *BPE) trainWords(words [][]byte, counts []int, vocabSize int) {
+	if t.ByteIDs != nil || len(t.MergeIDs) > 0 {
+		panic("tokenizer: cannot train on top of an imported vocabulary")
+	}
+	defer t.invalidate()
+
+	// 1. Initialize with all bytes
+	for i := 0; i < 256; i++ {
+		b := string([]byte{byte(i)})
+		t.Encoder[b] = i
+		t.Decoder[i] = b
+	}
+
+	tr := newBPETrainer(words, counts)
+
+	numMerges := vocabSize - 256
+	for i := 0; i < numMerges; i++ {
+		st, ok := tr.best()
+		if !ok {
+			break
+		}
+		a, b := splitKey(st.key)
+		idx := 256 + i
+
+		// Record merge
+		key := fmt.Sprintf("%d,%d", a, b)
+		t.Merges[key] = idx
+
+		// New token
+		tokenBytes := t.Decoder[int(a)] + t.Decoder[int(b)]
+		t.Decoder[idx] = tokenBytes
+		t.Encoder[tokenBytes] = idx
+
+		tr.merge(st, int32(idx))
+	}
+	t.renumberSpecial()
+	t.Size = 256 + len(t.Merges) + len(t.Special)
+}
+
+// pairQueue is a max-heap of pairs by count, then smallest key.
+type pairQueue []*pairStat
+
+func (q pairQueue) Len() int { return len(q) }
+
+func (q pairQueue) Less(i, j int) bool {
+	if q[i].count != q[j].count {
+		return q[i].count > q[j].count
+	}
+	return q[i].key < q[j].key
+}
+
+func (q pairQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *pairQueue) Push(x any) {
+	st := x.(*pairStat)
+	st.index = len(*q)
+	*q = append(*q, st)
+}
+
+func (q *pairQueue) Pop() any {
+	old := *q
+	st := old[len(old)-1]
+	old[len(old)-1] = nil
+	st.index = -1
+	*q = old[:len(old)-1]
+	return st
+}
@@ -0,0 +1,458 @@
+package tokenizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// Pieces are at most this many characters long.
+	maxPieceRunes = 16
+	// Training starts from this many times the target number of pieces.
+	unigramSeedFactor = 8
+	// Each pruning round keeps at least this share of the pieces.
+	unigramShrink = 0.75
+	// EM iterations between pruning rounds.
+	unigramEMIters = 2
+)
+
+// Unigram is a SentencePiece-style unigram language model tokenizer. Every
+// piece has a log probability, and text is encoded as its most probable
+// split into pieces (Viterbi). Whitespace belongs to the word that follows
+// it, like SentencePiece's "▁": " the" is a piece, "the " never is.
+//
+// Ids 0-255 are byte tokens. Characters that no piece covers fall back to
+// their bytes, so any text round-trips. The pieces follow, most probable
+// first, then the special tokens.
+type Unigram struct {
+	Pieces  []string       // Piece of id 256+i
+	Scores  []float64      // Log probability of Pieces[i]
+	Special map[string]int // Special token -> id, after the pieces
+
+	model    unigramModel
+	fallback float64 // Score of one byte token, below any piece
+}
+
+// NewUnigram returns an untrained unigram tokenizer.
+func NewUnigram() *Unigram {
+	u := &Unigram{}
+	u.reindex()
+	return u
+}
+
+func (u *Unigram) Type() string { return TypeUnigram }
+
+func (u *Unigram) VocabSize() int { return 256 + len(u.Pieces) + len(u.Special) }
+
+// unigramModel finds the pieces of a string.
+type unigramModel struct {
+	index  map[string]int // Piece -> index into scores
+	scores []float64
+	maxLen int // Longest piece in bytes
+}
+
+func newUnigramModel(pieces []string, scores []float64) unigramModel {
+	m := unigramModel{index: make(map[string]int, len(pieces)), scores: scores}
+	for i, p := range pieces {
+		m.index[p] = i
+		m.maxLen = max(m.maxLen, len(p))
+	}
+	return m
+}
+
+// segment is one piece of a Viterbi path; piece is -1 for a character
+// covered by byte fallback.
+type segment struct {
+	start, end int
+	piece      int
+}
+
+// viterbi returns the most probable split of s. The piece exclude (-1 for
+// none) is not used. Characters no piece covers cost fallback per byte; with
+// fallback 0 they cannot be covered and ok is false.
+func (m *unigramModel) viterbi(s string, exclude int, fallback float64) (path []segment, score float64, ok bool) {
+	n := len(s)
+	best := make([]float64, n+1)
+	from := make([]segment, n+1)
+	for i := 1; i <= n; i++ {
+		best[i] = math.Inf(-1)
+	}
+	for i := 0; i < n; i++ {
+		if math.IsInf(best[i], -1) {
+			continue
+		}
+		for l := 1; l <= m.maxLen && i+l <= n; l++ {
+			p, found := m.index[s[i:i+l]]
+			if !found || p == exclude {
+				continue
+			}
+			if sc := best[i] + m.scores[p]; sc > best[i+l] {
+				best[i+l], from[i+l] = sc, segment{i, i + l, p}
+			}
+		}
+		size := runeLen(s[i:])
+		if p, found := m.index[s[i:i+size]]; (!found || p == exclude) && fallback != 0 {
+			if sc := best[i] + fallback*float64(size); sc > best[i+size] {
+				best[i+size], from[i+size] = sc, segment{i, i + size, -1}
+			}
+		}
+	}
+	if math.IsInf(best[n], -1) {
+		return nil, 0, false
+	}
+	for j := n; j > 0; j = from[j].start {
+		path = append(path, from[j])
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path, best[n], true
+}
+
+// expect adds count times the expected number of uses of each piece over
+// all splits of s to counts (the E step of EM).
+func (m *unigramModel) expect(s string, count float64, counts []float64) {
+	n := len(s)
+	alpha := make([]float64, n+1)
+	beta := make([]float64, n+1)
+	for i := range alpha {
+		alpha[i], beta[i] = math.Inf(-1), math.Inf(-1)
+	}
+	alpha[0], beta[n] = 0, 0
+	m.edges(s, func(i, j, p int) {
+		alpha[j] = logAdd(alpha[j], alpha[i]+m.scores[p])
+	})
+	for i := n - 1; i >= 0; i-- {
+		for l := 1; l <= m.maxLen && i+l <= n; l++ {
+			if p, ok := m.index[s[i:i+l]]; ok {
+				beta[i] = logAdd(beta[i], m.scores[p]+beta[i+l])
+			}
+		}
+	}
+	z := alpha[n]
+	if math.IsInf(z, -1) {
+		return
+	}
+	m.edges(s, func(i, j, p int) {
+		counts[p] += count * math.Exp(alpha[i]+m.scores[p]+beta[j]-z)
+	})
+}
+
+// edges calls f for every occurrence of a piece in s, by start position.
+func (m *unigramModel) edges(s string, f func(i, j, p int)) {
+	for i := 0; i < len(s); i++ {
+		for l := 1; l <= m.maxLen && i+l <= len(s); l++ {
+			if p, ok := m.index[s[i:i+l]]; ok {
+				f(i, i+l, p)
+			}
+		}
+	}
+}
+
+func logAdd(a, b float64) float64 {
+	if math.IsInf(a, -1) {
+		return b
+	}
+	if math.IsInf(b, -1) {
+		return a
+	}
+	if a < b {
+		a, b = b, a
+	}
+	return a + math.Log1p(math.Exp(b-a))
+}
+
+func runeLen(s string) int {
+	_, size := utf8.DecodeRuneInString(s)
+	return size
+}
+
+// splitWords cuts text before every run of whitespace that follows other
+// text. Pieces never cross these cuts.
+func splitWords(text string) []string {
+	var words []string
+	start := 0
+	for i := 1; i < len(text); i++ {
+		if isSpace(text[i]) && !isSpace(text[i-1]) {
+			words = append(words, text[start:i])
+			start = i
+		}
+	}
+	if start < len(text) {
+		words = append(words, text[start:])
+	}
+	return words
+}
+
+// Train learns pieces from text until the vocabulary (byte and special
+// tokens included) has vocabSize tokens. It starts from the most frequent
+// substrings of the words, re-estimates their probabilities with EM and
+// repeatedly drops the pieces whose removal costs the least likelihood.
+// Single characters are kept as long as the size allows.
+func (u *Unigram) Train(text string, vocabSize int) {
+	counts := make(map[string]int)
+	for _, span := range splitSpecial(text, specialSet(u.Special)) {
+		if _, ok := u.Special[span]; ok {
+			continue
+		}
+		for _, w := range splitWords(span) {
+			counts[w]++
+		}
+	}
+	words := make([]string, 0, len(counts))
+	for w := range counts {
+		words = append(words, w)
+	}
+	sort.Strings(words)
+	target := max(vocabSize-256-len(u.Special), 0)
+
+	// Seed pieces: every character, and the substrings that cover the most text
+	freq := make(map[string]int)
+	for _, w := range words {
+		for i := 0; i < len(w); i += runeLen(w[i:]) {
+			j := i
+			for r := 0; r < maxPieceRunes && j < len(w); r++ {
+				j += runeLen(w[j:])
+				freq[w[i:j]] += counts[w]
+			}
+		}
+	}
+	var chars, multi []string
+	for p := range freq {
+		if !utf8.ValidString(p) {
+			continue // Left to byte fallback; JSON could not store it anyway
+		}
+		if utf8.RuneCountInString(p) == 1 {
+			chars = append(chars, p)
+		} else if freq[p] > 1 {
+			multi = append(multi, p)
+		}
+	}
+	sort.Strings(chars)
+	sort.Slice(multi, func(i, j int) bool {
+		si, sj := freq[multi[i]]*len(multi[i]), freq[multi[j]]*len(multi[j])
+		if si != sj {
+			return si > sj
+		}
+		return multi[i] < multi[j]
+	})
+	if n := unigramSeedFactor * target; len(multi) > n {
+		multi = multi[:n]
+	}
+	pieces := append(chars, multi...)
+	scores := make([]float64, len(pieces))
+	total := 0.0
+	for _, p := range pieces {
+		total += float64(freq[p])
+	}
+	for i, p := range pieces {
+		scores[i] = math.Log(float64(freq[p]) / total)
+	}
+
+	for {
+		for it := 0; it < unigramEMIters; it++ {
+			pieces, scores = unigramEM(pieces, scores, words, counts)
+		}
+		if len(pieces) <= target {
+			break
+		}
+		n := len(pieces)
+		pieces, scores = unigramPrune(pieces, scores, words, counts, target)
+		if len(pieces) == n {
+			break // Only characters left
+		}
+	}
+
+	// Most probable first; when there are more characters than room, the
+	// rarest ones are left to byte fallback
+	order := make([]int, len(pieces))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		a, b := order[i], order[j]
+		if scores[a] != scores[b] {
+			return scores[a] > scores[b]
+		}
+		return pieces[a] < pieces[b]
+	})
+	if len(order) > target {
+		order = order[:target]
+	}
+	u.Pieces = make([]string, len(order))
+	u.Scores = make([]float64, len(order))
+	for i, k := range order {
+		u.Pieces[i], u.Scores[i] = pieces[k], scores[k]
+	}
+	for i, tok := range specialTokens(u.Special) {
+		u.Special[tok] = 256 + len(u.Pieces) + i
+	}
+	u.reindex()
+}
+
+// unigramEM runs one EM iteration and drops pieces that are expected to be
+// used less than half a time (except characters).
+func unigramEM(pieces []string, scores []float64, words []string, counts map[string]int) ([]string, []float64) {
+	m := newUnigramModel(pieces, scores)
+	expected := make([]float64, len(pieces))
+	for _, w := range words {
+		m.expect(w, float64(counts[w]), expected)
+	}
+
+	var keptPieces []string
+	var kept []float64
+	total := 0.0
+	for i, p := range pieces {
+		if expected[i] < 0.5 && utf8.RuneCountInString(p) > 1 {
+			continue
+		}
+		keptPieces = append(keptPieces, p)
+		kept = append(kept, expected[i])
+		total += expected[i]
+	}
+	total = max(total, 1)
+	for i, e := range kept {
+		kept[i] = math.Log(max(e, 1e-10) / total)
+	}
+	return keptPieces, kept
+}
+
+// unigramPrune keeps the characters and the multi-character pieces whose
+// removal would lose the most likelihood, shrinking towards target.
+func unigramPrune(pieces []string, scores []float64, words []string, counts map[string]int, target int) ([]string, []float64) {
+	m := newUnigramModel(pieces, scores)
+	used := make([]float64, len(pieces))
+	for _, w := range words {
+		path, _, _ := m.viterbi(w, -1, 0)
+		for _, seg := range path {
+			used[seg.piece] += float64(counts[w])
+		}
+	}
+
+	// Loss of a piece: its uses times how much worse the best split
+	// without it is
+	var chars, multi []int
+	loss := make([]float64, len(pieces))
+	for i, p := range pieces {
+		if utf8.RuneCountInString(p) == 1 {
+			chars = append(chars, i)
+			continue
+		}
+		multi = append(multi, i)
+		if used[i] > 0 {
+			_, alt, _ := m.viterbi(p, i, 0)
+			loss[i] = used[i] * (scores[i] - alt)
+		}
+	}
+	sort.Slice(multi, func(a, b int) bool {
+		if loss[multi[a]] != loss[multi[b]] {
+			return loss[multi[a]] > loss[multi[b]]
+		}
+		return pieces[multi[a]] < pieces[multi[b]]
+	})
+	keep := max(target-len(chars), int(unigramShrink*float64(len(multi))))
+	if keep > len(multi) {
+		keep = len(multi)
+	}
+	if keep == len(multi) && keep > 0 {
+		keep-- // Always make progress
+	}
+
+	var outPieces []string
+	var outScores []float64
+	for _, i := range append(chars, multi[:keep]...) {
+		outPieces = append(outPieces, pieces[i])
+		outScores = append(outScores, scores[i])
+	}
+	return outPieces, outScores
+}
+
+func (u *Unigram) reindex() {
+	u.model = newUnigramModel(u.Pieces, u.Scores)
+	minScore := 0.0
+	for _, s := range u.Scores {
+		minScore = min(minScore, s)
+	}
+	u.fallback = minScore - 10
+}
+
+// Encode returns the ids of the most probable split of text.
+func (u *Unigram) Encode(text string) []int {
+	var ids []int
+	for _, w := range splitWords(text) {
+		path, _, _ := u.model.viterbi(w, -1, u.fallback)
+		for _, seg := range path {
+			if seg.piece >= 0 {
+				ids = append(ids, 256+seg.piece)
+				continue
+			}
+			for i := seg.start; i < seg.end; i++ {
+				ids = append(ids, int(w[i]))
+			}
+		}
+	}
+	return ids
+}
+
+func (u *Unigram) EncodeWithPolicy(text string, p SpecialPolicy) ([]int, error) {
+	return encodeWithPolicy(u.Special, u.Encode, text, p)
+}
+
+func (u *Unigram) Decode(ids []int) string {
+	var sb strings.Builder
+	for _, id := range ids {
+		tok, _ := u.Token(id)
+		sb.WriteString(tok)
+	}
+	return sb.String()
+}
+
+func (u *Unigram) Token(id int) (string, bool) {
+	switch {
+	case id >= 0 && id < 256:
+		return string([]byte{byte(id)}), true
+	case id >= 256 && id < 256+len(u.Pieces):
+		return u.Pieces[id-256], true
+	}
+	return specialToken(u.Special, id)
+}
+
+// AddSpecial registers special tokens after the current vocabulary. Train
+// renumbers them to follow the learned pieces.
+func (u *Unigram) AddSpecial(tokens ...string) {
+	u.Special = addSpecial(u.Special, u.VocabSize(), tokens)
+}
+
+func (u *Unigram) SpecialID(tok string) (int, bool) {
+	id, ok := u.Special[tok]
+	return id, ok
+}
+
+func (u *Unigram) Save(path string) error {
+	return saveJSON(path, struct {
+		Type string
+		*Unigram
+	}{TypeUnigram, u})
+}
+
+// LoadUnigram reads a unigram tokenizer written by Save.
+func LoadUnigram(path string) (*Unigram, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	u := NewUnigram()
+	if err := json.Unmarshal(data, u); err != nil {
+		return nil, err
+	}
+	if len(u.Pieces) != len(u.Scores) {
+		return nil, fmt.Errorf("%s: %d pieces but %d scores", path, len(u.Pieces), len(u.Scores))
+	}
+	u.reindex()
+	return u, nil
+}
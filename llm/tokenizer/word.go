@@ -0,0 +1,198 @@
+package tokenizer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Word is a word-level tokenizer. Text is split into words (runs of
+// letters, digits and marks, each with the space before it, if any) and
+// single other characters; the most frequent words are tokens, and words
+// outside the vocabulary are spelled out character by character, so every
+// character seen in training still round-trips.
+type Word struct {
+	Words   []string       // id -> word or character; Words[0] is unknownChar
+	Special map[string]int // Special token -> id, after the words
+
+	index map[string]int
+}
+
+// NewWord returns an untrained word tokenizer.
+func NewWord() *Word {
+	return &Word{Words: []string{unknownChar}}
+}
+
+func (w *Word) Type() string { return TypeWord }
+
+func (w *Word) VocabSize() int { return len(w.Words) + len(w.Special) }
+
+// Train keeps every character of text, then the most frequent words up to
+// vocabSize tokens, counting the unknown and special tokens. If the
+// characters alone do not fit, only the most frequent of them are kept.
+// Ties go to the lower code point or the lexically smaller word.
+func (w *Word) Train(text string, vocabSize int) {
+	charCounts := make(map[string]int)
+	wordCounts := make(map[string]int)
+	for _, span := range splitSpecial(text, specialSet(w.Special)) {
+		if _, ok := w.Special[span]; ok {
+			continue
+		}
+		for _, r := range span {
+			if r != utf8.RuneError {
+				charCounts[string(r)]++
+			}
+		}
+		for _, piece := range wordPieces(span) {
+			if utf8.RuneCountInString(piece) > 1 && !strings.ContainsRune(piece, utf8.RuneError) {
+				wordCounts[piece]++
+			}
+		}
+	}
+
+	budget := max(vocabSize-1-len(w.Special), 0)
+	chars := mostFrequent(charCounts, budget)
+	sort.Strings(chars) // Code point order
+	words := mostFrequent(wordCounts, budget-len(chars))
+
+	w.Words = append([]string{unknownChar}, chars...)
+	w.Words = append(w.Words, words...)
+	// Special tokens follow the words, keeping their order
+	for i, tok := range specialTokens(w.Special) {
+		w.Special[tok] = len(w.Words) + i
+	}
+	w.reindex()
+}
+
+// mostFrequent returns the n most frequent keys of counts (all of them if
+// there are fewer), most frequent first.
+func mostFrequent(counts map[string]int, n int) []string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys[:min(max(n, 0), len(keys))]
+}
+
+func (w *Word) reindex() {
+	w.index = make(map[string]int, len(w.Words))
+	for id, word := range w.Words[1:] {
+		w.index[word] = id + 1
+	}
+}
+
+// wordPieces splits text into words, each with at most one space in front,
+// and single characters.
+func wordPieces(text string) []string {
+	isWord := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+	}
+	var pieces []string
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		end := i + size
+		if r == ' ' {
+			if next, _ := utf8.DecodeRuneInString(text[end:]); end < len(text) && isWord(next) {
+				r = next
+			}
+		}
+		if isWord(r) {
+			for end < len(text) {
+				next, size := utf8.DecodeRuneInString(text[end:])
+				if !isWord(next) {
+					break
+				}
+				end += size
+			}
+		}
+		pieces = append(pieces, text[i:end])
+		i = end
+	}
+	return pieces
+}
+
+// Encode returns one id per known word, or per character of unknown words.
+func (w *Word) Encode(text string) []int {
+	var ids []int
+	for _, piece := range wordPieces(text) {
+		if id, ok := w.index[piece]; ok {
+			ids = append(ids, id)
+			continue
+		}
+		for _, r := range piece {
+			ids = append(ids, w.index[string(r)]) // 0 if unknown
+		}
+	}
+	return ids
+}
+
+func (w *Word) EncodeWithPolicy(text string, p SpecialPolicy) ([]int, error) {
+	return encodeWithPolicy(w.Special, w.Encode, text, p)
+}
+
+func (w *Word) Decode(ids []int) string {
+	var sb strings.Builder
+	for _, id := range ids {
+		tok, _ := w.Token(id)
+		sb.WriteString(tok)
+	}
+	return sb.String()
+}
+
+func (w *Word) Token(id int) (string, bool) {
+	if id >= 0 && id < len(w.Words) {
+		return w.Words[id], true
+	}
+	return specialToken(w.Special, id)
+}
+
+// AddSpecial registers special tokens after the current vocabulary.
+func (w *Word) AddSpecial(tokens ...string) {
+	w.Special = addSpecial(w.Special, w.VocabSize(), tokens)
+}
+
+func (w *Word) SpecialID(tok string) (int, bool) {
+	id, ok := w.Special[tok]
+	return id, ok
+}
+
+func (w *Word) Save(path string) error {
+	return saveJSON(path, struct {
+		Type string
+		*Word
+	}{TypeWord, w})
+}
+
+// LoadWord reads a word tokenizer written by Save.
+func LoadWord(path string) (*Word, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	w := NewWord()
+	if err := json.Unmarshal(data, w); err != nil {
+		return nil, err
+	}
+	if len(w.Words) == 0 || w.Words[0] != unknownChar {
+		return nil, fmt.Errorf("%s: word vocabulary must start with %q", path, unknownChar)
+	}
+	seen := make(map[string]bool, len(w.Words))
+	for _, word := range w.Words[1:] {
+		if word == "" || seen[word] {
+			return nil, fmt.Errorf("%s: empty or duplicate word %q", path, word)
+		}
+		seen[word] = true
+	}
+	w.reindex()
+	return w, nil
+}
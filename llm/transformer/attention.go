@@ -3,6 +3,7 @@ package transformer
 import (
 	"math"
 
+	"github.com/brucetruth/minigpt/llm/backend"
 	"github.com/brucetruth/minigpt/llm/nn"
 	"github.com/brucetruth/minigpt/llm/tensor"
 )
@@ -34,16 +35,52 @@ func NewCausalSelfAttention(cfg Config) *CausalSelfAttention {
 func (csa *CausalSelfAttention) Forward(x *tensor.NDArray) *tensor.NDArray {
 	// x: [B, T, C]
 	csa.input = x
-	B, T, C := x.Shape[0], x.Shape[1], x.Shape[2]
-	headDim := C / csa.NHead
 	
 	// 1. QKV projection
 	qkv := csa.CAttn.Forward(x) // [B, T, 3C]
 	
 	// 2. Split and Reshape
-	q := tensor.New(B, csa.NHead, T, headDim)
-	k := tensor.New(B, csa.NHead, T, headDim)
-	v := tensor.New(B, csa.NHead, T, headDim)
+	q, k, v := splitHeads(qkv, csa.NHead)
+	
+	csa.q = q
+	csa.k = k
+	csa.v = v
+	
+	// 3. Causal attention over all positions
+	y, probs := attend(q, k, v, 0)
+	csa.att = probs
+	
+	// 4. Reassemble -> [B, T, C]
+	out := mergeHeads(y)
+	
+	return csa.CProj.Forward(out)
+}
+
+// ForwardStep runs attention for new positions pos..pos+T-1 of a single
+// sequence, x: [1, T, C]. Keys and values of the new positions are written
+// into cache, and the queries attend to everything cached so far.
+func (csa *CausalSelfAttention) ForwardStep(x *tensor.NDArray, cache *LayerCache, pos int) *tensor.NDArray {
+	T := x.Shape[1]
+	qkv := csa.CAttn.Forward(x) // [1, T, 3C]
+	q, k, v := splitHeads(qkv, csa.NHead)
+	
+	// Store new keys/values, then view all L = pos+T positions as [1, H, L, D]
+	cache.write(k, v, pos)
+	kAll, vAll := cache.read(pos + T)
+	
+	y, _ := attend(q, kAll, vAll, pos)
+	return csa.CProj.Forward(mergeHeads(y))
+}
+
+// splitHeads splits a fused [B, T, 3C] projection into q, k, v of shape [B, H, T, D].
+func splitHeads(qkv *tensor.NDArray, nHead int) (*tensor.NDArray, *tensor.NDArray, *tensor.NDArray) {
+	B, T := qkv.Shape[0], qkv.Shape[1]
+	C := qkv.Shape[2] / 3
+	headDim := C / nHead
+	
+	q := tensor.New(B, nHead, T, headDim)
+	k := tensor.New(B, nHead, T, headDim)
+	v := tensor.New(B, nHead, T, headDim)
 	
 	strideQKV := 3 * C
 	
@@ -51,26 +88,49 @@ func (csa *CausalSelfAttention) Forward(x *tensor.NDArray) *tensor.NDArray {
 		for t := 0; t < T; t++ {
 			offsetSrc := (b*T + t) * strideQKV
 			
-			for h := 0; h < csa.NHead; h++ {
+			for h := 0; h < nHead; h++ {
+				offsetDst := ((b*nHead+h)*T + t) * headDim
 				for d := 0; d < headDim; d++ {
-					// Q
-					q.Data[((b*csa.NHead + h)*T + t)*headDim + d] = qkv.Data[offsetSrc + h*headDim + d]
-					// K
-					k.Data[((b*csa.NHead + h)*T + t)*headDim + d] = qkv.Data[offsetSrc + C + h*headDim + d]
-					// V
-					v.Data[((b*csa.NHead + h)*T + t)*headDim + d] = qkv.Data[offsetSrc + 2*C + h*headDim + d]
+					q.Data[offsetDst+d] = qkv.Data[offsetSrc+h*headDim+d]
+					k.Data[offsetDst+d] = qkv.Data[offsetSrc+C+h*headDim+d]
+					v.Data[offsetDst+d] = qkv.Data[offsetSrc+2*C+h*headDim+d]
 				}
 			}
 		}
 	}
+	return q, k, v
+}
+
+// mergeHeads is the inverse of the per-head split: [B, H, T, D] -> [B, T, H*D].
+func mergeHeads(y *tensor.NDArray) *tensor.NDArray {
+	B, nHead, T, headDim := y.Shape[0], y.Shape[1], y.Shape[2], y.Shape[3]
+	C := nHead * headDim
 	
-	csa.q = q
-	csa.k = k
-	csa.v = v
+	out := tensor.New(B, T, C)
+	for b := 0; b < B; b++ {
+		for t := 0; t < T; t++ {
+			for h := 0; h < nHead; h++ {
+				offsetSrc := ((b*nHead+h)*T + t) * headDim
+				for d := 0; d < headDim; d++ {
+					out.Data[(b*T+t)*C+h*headDim+d] = y.Data[offsetSrc+d]
+				}
+			}
+		}
+	}
+	return out
+}
+
+// attend computes softmax(q k^T / sqrt(D)) v under a causal mask.
+// q: [B, H, Tq, D] holds queries for positions offset..offset+Tq-1,
+// k, v: [B, H, Tk, D] hold keys and values for positions 0..Tk-1.
+// Returns the output [B, H, Tq, D] and the attention probs [B, H, Tq, Tk].
+func attend(q, k, v *tensor.NDArray, offset int) (*tensor.NDArray, *tensor.NDArray) {
+	Tq, headDim := q.Shape[2], q.Shape[3]
+	Tk := k.Shape[2]
+	rows := q.Shape[0] * q.Shape[1]
 	
-	// 3. Q @ K^T
-	kt := tensor.Transpose(k)
-	att := tensor.MatMul(q, kt) // [B, H, T, T]
+	// Q @ K^T
+	att := backend.BatchedMatMul(q, k, false, true) // [B, H, Tq, Tk]
 	
 	// Scale
 	scale := float32(1.0 / math.Sqrt(float64(headDim)))
@@ -78,42 +138,22 @@ func (csa *CausalSelfAttention) Forward(x *tensor.NDArray) *tensor.NDArray {
 		att.Data[i] *= scale
 	}
 	
-	// Mask (Causal)
-	minVal := float32(math.Inf(-1)) // Should handle this appropriately if strict float32
-	// For compat: usually -1e9 or similar
-	minVal = -1e9
+	// Mask (Causal). -1e9 rather than -Inf keeps the softmax free of NaNs.
+	minVal := float32(-1e9)
 	
-	for t1 := 0; t1 < T; t1++ {
-		for t2 := 0; t2 < T; t2++ {
-			if t2 > t1 {
-				for b := 0; b < B*csa.NHead; b++ {
-					att.Data[(b*T + t1)*T + t2] = minVal
-				}
+	for t1 := 0; t1 < Tq; t1++ {
+		for t2 := offset + t1 + 1; t2 < Tk; t2++ {
+			for r := 0; r < rows; r++ {
+				att.Data[(r*Tq+t1)*Tk+t2] = minVal
 			}
 		}
 	}
 	
 	// Softmax
-	probs := tensor.Softmax(att)
-	csa.att = probs
-	
-	// 4. Probs @ V
-	y := tensor.MatMul(probs, v)
-	
-	// 5. Reassemble -> [B, T, C]
-	out := tensor.New(B, T, C)
-	for b := 0; b < B; b++ {
-		for t := 0; t < T; t++ {
-			for h := 0; h < csa.NHead; h++ {
-				for d := 0; d < headDim; d++ {
-					val := y.Data[((b*csa.NHead + h)*T + t)*headDim + d]
-					out.Data[(b*T + t)*C + h*headDim + d] = val
-				}
-			}
-		}
-	}
+	probs := backend.Softmax(att)
 	
-	return csa.CProj.Forward(out)
+	// Probs @ V
+	return backend.MatMul(probs, v), probs
 }
 
 func (csa *CausalSelfAttention) Backward(gradOutput *tensor.NDArray) *tensor.NDArray {
@@ -142,12 +182,10 @@ func (csa *CausalSelfAttention) Backward(gradOutput *tensor.NDArray) *tensor.NDA
 	
 	// 2. dV = P^T * dY
 	// P: [B, H, T, T]
-	pt := tensor.Transpose(csa.att)
-	dV := tensor.MatMul(pt, dY) // [B, H, T, D]
+	dV := backend.BatchedMatMul(csa.att, dY, true, false) // [B, H, T, D]
 	
 	// 3. dP = dY * V^T
-	vt := tensor.Transpose(csa.v)
-	dP := tensor.MatMul(dY, vt) // [B, H, T, T]
+	dP := backend.BatchedMatMul(dY, csa.v, false, true) // [B, H, T, T]
 	
 	// 4. dS = P * (dP - sum(dP * P))
 	// Softmax backward
@@ -182,11 +220,10 @@ func (csa *CausalSelfAttention) Backward(gradOutput *tensor.NDArray) *tensor.NDA
 	}
 	
 	// 6. dQ = dS * K  ( [B,H,T,T] * [B,H,T,D] -> [B,H,T,D] )
-	dQ := tensor.MatMul(dS, csa.k)
+	dQ := backend.MatMul(dS, csa.k)
 	
 	// 7. dK = dS^T * Q ( [B,H,T,T]^T * [B,H,T,D] -> [B,H,T,D] )
-	dSt := tensor.Transpose(dS)
-	dK := tensor.MatMul(dSt, csa.q)
+	dK := backend.BatchedMatMul(dS, csa.q, true, false)
 	
 	// 8. Reassemble dQ, dK, dV into dQKV [B, T, 3C]
 	dQKV := tensor.New(B, T, 3*csa.NEmb)
@@ -218,3 +255,10 @@ func (csa *CausalSelfAttention) Parameters() []*nn.Parameter {
 	p = append(p, csa.CProj.Parameters()...)
 	return p
 }
+
+// NamedParameters uses the GPT-2 names c_attn and c_proj for CAttn and CProj.
+func (csa *CausalSelfAttention) NamedParameters(prefix string) []nn.NamedParameter {
+	p := csa.CAttn.NamedParameters(nn.JoinName(prefix, "c_attn"))
+	p = append(p, csa.CProj.NamedParameters(nn.JoinName(prefix, "c_proj"))...)
+	return p
+}
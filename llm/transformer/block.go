@@ -1,6 +1,7 @@
 package transformer
 
 import (
+	"github.com/brucetruth/minigpt/llm/backend"
 	"github.com/brucetruth/minigpt/llm/nn"
 	"github.com/brucetruth/minigpt/llm/tensor"
 )
@@ -30,17 +31,29 @@ func (b *Block) Forward(x *tensor.NDArray) *tensor.NDArray {
 	normalized := b.LN1.Forward(x)
 	attnOut := b.Attn.Forward(normalized)
 	attnOut = b.Drop1.Forward(attnOut)
-	x = tensor.Add(x, attnOut)
+	x = backend.Add(x, attnOut)
 
 	// x = x + dropout(mlp(ln2(x)))
 	normalized2 := b.LN2.Forward(x)
 	mlpOut := b.MLP.Forward(normalized2)
 	mlpOut = b.Drop2.Forward(mlpOut)
-	x = tensor.Add(x, mlpOut)
+	x = backend.Add(x, mlpOut)
 
 	return x
 }
 
+// ForwardStep is Forward for new positions of a cached sequence.
+// See CausalSelfAttention.ForwardStep.
+func (b *Block) ForwardStep(x *tensor.NDArray, cache *LayerCache, pos int) *tensor.NDArray {
+	attnOut := b.Attn.ForwardStep(b.LN1.Forward(x), cache, pos)
+	attnOut = b.Drop1.Forward(attnOut)
+	x = backend.Add(x, attnOut)
+
+	mlpOut := b.MLP.Forward(b.LN2.Forward(x))
+	mlpOut = b.Drop2.Forward(mlpOut)
+	return backend.Add(x, mlpOut)
+}
+
 func (b *Block) Backward(gradOutput *tensor.NDArray) *tensor.NDArray {
 	// Backward through second residual: x = x + drop2(mlp(ln2(x)))
 	// gradOutput flows to both branches
@@ -51,7 +64,7 @@ func (b *Block) Backward(gradOutput *tensor.NDArray) *tensor.NDArray {
 	dLN2 := b.LN2.Backward(dMLP)
 
 	// Combine gradient at x (residual adds gradients)
-	dx_mid := tensor.Add(gradOutput, dLN2)
+	dx_mid := backend.Add(gradOutput, dLN2)
 
 	// Branch 1: Attention path
 	dDrop1 := b.Drop1.Backward(dx_mid)
@@ -59,7 +72,7 @@ func (b *Block) Backward(gradOutput *tensor.NDArray) *tensor.NDArray {
 	dLN1 := b.LN1.Backward(dAttn)
 
 	// Final dx = dx_mid + dLN1
-	return tensor.Add(dx_mid, dLN1)
+	return backend.Add(dx_mid, dLN1)
 }
 
 func (b *Block) Parameters() []*nn.Parameter {
@@ -69,3 +82,12 @@ func (b *Block) Parameters() []*nn.Parameter {
 	p = append(p, b.MLP.Parameters()...)
 	return p
 }
+
+// NamedParameters names the sublayers ln_1, attn, ln_2 and mlp under prefix.
+func (b *Block) NamedParameters(prefix string) []nn.NamedParameter {
+	p := b.LN1.NamedParameters(nn.JoinName(prefix, "ln_1"))
+	p = append(p, b.Attn.NamedParameters(nn.JoinName(prefix, "attn"))...)
+	p = append(p, b.LN2.NamedParameters(nn.JoinName(prefix, "ln_2"))...)
+	p = append(p, b.MLP.NamedParameters(nn.JoinName(prefix, "mlp"))...)
+	return p
+}
@@ -0,0 +1,98 @@
+package transformer
+
+import (
+	"github.com/brucetruth/minigpt/llm/tensor"
+)
+
+// KVCache holds the keys and values of every layer for the positions that
+// have already been processed, so decoding only has to run the newest tokens.
+// A cache belongs to a single sequence (batch size 1).
+type KVCache struct {
+	Layers []*LayerCache
+
+	// Keep is the number of most recent tokens GPT.NextLogits rebuilds the
+	// cache from when the window overflows. 0 (or BlockSize) keeps a whole
+	// window, which matches Forward on the cropped context exactly; smaller
+	// values make rebuilds rarer but drop the older context.
+	Keep int
+
+	tokens []int // Token ids at positions 0..Len()-1
+}
+
+// LayerCache stores keys and values for one attention layer.
+type LayerCache struct {
+	K *tensor.NDArray // [H, BlockSize, D]
+	V *tensor.NDArray // [H, BlockSize, D]
+}
+
+// NewKVCache allocates an empty cache sized for cfg.BlockSize positions.
+func NewKVCache(cfg Config) *KVCache {
+	headDim := cfg.NEmb / cfg.NHead
+	layers := make([]*LayerCache, cfg.NLayer)
+	for i := range layers {
+		layers[i] = &LayerCache{
+			K: tensor.New(cfg.NHead, cfg.BlockSize, headDim),
+			V: tensor.New(cfg.NHead, cfg.BlockSize, headDim),
+		}
+	}
+	return &KVCache{
+		Layers: layers,
+		tokens: make([]int, 0, cfg.BlockSize),
+	}
+}
+
+// Len returns the number of cached positions.
+func (c *KVCache) Len() int {
+	return len(c.tokens)
+}
+
+// Tokens returns a copy of the token ids held in the cache.
+func (c *KVCache) Tokens() []int {
+	out := make([]int, len(c.tokens))
+	copy(out, c.tokens)
+	return out
+}
+
+// Truncate drops every position from n onwards. Stale keys and values are
+// simply overwritten by later steps.
+func (c *KVCache) Truncate(n int) {
+	if n < 0 {
+		n = 0
+	}
+	if n < len(c.tokens) {
+		c.tokens = c.tokens[:n]
+	}
+}
+
+// Reset empties the cache so it can be reused for a new sequence.
+func (c *KVCache) Reset() {
+	c.Truncate(0)
+}
+
+// write copies k, v: [1, H, T, D] into positions pos..pos+T-1.
+func (lc *LayerCache) write(k, v *tensor.NDArray, pos int) {
+	nHead, T, headDim := k.Shape[1], k.Shape[2], k.Shape[3]
+	capacity := lc.K.Shape[1]
+
+	for h := 0; h < nHead; h++ {
+		src := h * T * headDim
+		dst := (h*capacity + pos) * headDim
+		copy(lc.K.Data[dst:dst+T*headDim], k.Data[src:src+T*headDim])
+		copy(lc.V.Data[dst:dst+T*headDim], v.Data[src:src+T*headDim])
+	}
+}
+
+// read returns the first n positions as contiguous [1, H, n, D] tensors.
+func (lc *LayerCache) read(n int) (*tensor.NDArray, *tensor.NDArray) {
+	nHead, capacity, headDim := lc.K.Shape[0], lc.K.Shape[1], lc.K.Shape[2]
+
+	k := tensor.New(1, nHead, n, headDim)
+	v := tensor.New(1, nHead, n, headDim)
+	for h := 0; h < nHead; h++ {
+		src := h * capacity * headDim
+		dst := h * n * headDim
+		copy(k.Data[dst:dst+n*headDim], lc.K.Data[src:src+n*headDim])
+		copy(v.Data[dst:dst+n*headDim], lc.V.Data[src:src+n*headDim])
+	}
+	return k, v
+}
@@ -1,6 +1,10 @@
 package transformer
 
 import (
+	"fmt"
+	"math/rand"
+
+	"github.com/brucetruth/minigpt/llm/backend"
 	"github.com/brucetruth/minigpt/llm/nn"
 	"github.com/brucetruth/minigpt/llm/tensor"
 )
@@ -31,6 +35,11 @@ func NewGPT(cfg Config) *GPT {
 		gpt.Blocks[i] = NewBlock(cfg)
 	}
 	
+	// Give every parameter its unique qualified name
+	for _, np := range gpt.NamedParameters() {
+		np.Param.Name = np.Name
+	}
+	
 	return gpt
 }
 
@@ -68,7 +77,7 @@ func (gpt *GPT) Forward(idx *tensor.NDArray) *tensor.NDArray {
 	}
 	posEmb := gpt.WPE.ForwardIndices(flatPos, B, T)
 	
-	x := tensor.Add(tokEmb, posEmb)
+	x := backend.Add(tokEmb, posEmb)
 	x = gpt.Drop.Forward(x)
 	
 	// Blocks
@@ -83,6 +92,94 @@ func (gpt *GPT) Forward(idx *tensor.NDArray) *tensor.NDArray {
 	return logits
 }
 
+// SetRand makes every dropout layer draw its masks from r, so the random
+// stream can be owned (and checkpointed) by the caller.
+func (gpt *GPT) SetRand(r *rand.Rand) {
+	for _, d := range gpt.dropouts() {
+		d.Rand = r
+	}
+}
+
+// SetTraining switches dropout on (training, the default) or off
+// (evaluation). Evaluation draws nothing from the random stream.
+func (gpt *GPT) SetTraining(training bool) {
+	for _, d := range gpt.dropouts() {
+		d.Eval = !training
+	}
+}
+
+func (gpt *GPT) dropouts() []*nn.Dropout {
+	ds := []*nn.Dropout{gpt.Drop}
+	for _, b := range gpt.Blocks {
+		ds = append(ds, b.Drop1, b.Drop2, b.MLP.Drop)
+	}
+	return ds
+}
+
+// ForwardStep runs only the new tokens ids through the model, reusing the
+// keys and values stored in cache for earlier positions, and appends ids to
+// the cache. Returns logits [1, len(ids), Vocab] identical to what Forward
+// would produce for those positions given the whole sequence.
+func (gpt *GPT) ForwardStep(ids []int, cache *KVCache) *tensor.NDArray {
+	pos := cache.Len()
+	T := len(ids)
+	if pos+T > gpt.Config.BlockSize {
+		panic(fmt.Sprintf("kv cache overflow: %d cached + %d new > block size %d", pos, T, gpt.Config.BlockSize))
+	}
+	
+	flatPos := make([]int, T)
+	for t := range flatPos {
+		flatPos[t] = pos + t
+	}
+	
+	tokEmb := gpt.WTE.ForwardIndices(ids, 1, T)
+	posEmb := gpt.WPE.ForwardIndices(flatPos, 1, T)
+	
+	x := backend.Add(tokEmb, posEmb)
+	x = gpt.Drop.Forward(x)
+	
+	for i, block := range gpt.Blocks {
+		x = block.ForwardStep(x, cache.Layers[i], pos)
+	}
+	
+	x = gpt.LNF.Forward(x)
+	logits := gpt.LMHead.Forward(x)
+	
+	cache.tokens = append(cache.tokens, ids...)
+	return logits
+}
+
+// NextLogits feeds ids into cache and returns the next-token logits [Vocab]
+// after the last of them. When the context window would overflow, the cache
+// is rebuilt from the last BlockSize tokens, so the logits are the same as
+// Forward over that window (the context is cropped like in training). Each
+// step of a full window then reprocesses the whole window; set cache.Keep to
+// rebuild from fewer tokens less often, at the price of conditioning on a
+// shorter context right after each rebuild.
+func (gpt *GPT) NextLogits(ids []int, cache *KVCache) *tensor.NDArray {
+	if len(ids) == 0 {
+		panic("NextLogits requires at least one token")
+	}
+	
+	blockSize := gpt.Config.BlockSize
+	if cache.Len()+len(ids) > blockSize {
+		all := append(cache.Tokens(), ids...)
+		keep := blockSize
+		if cache.Keep > 0 && cache.Keep < blockSize {
+			keep = max(cache.Keep, min(len(ids), blockSize))
+		}
+		ids = all[len(all)-keep:]
+		cache.Reset()
+	}
+	
+	logits := gpt.ForwardStep(ids, cache)
+	
+	// Last position: [1, T, V] -> [V]
+	vocabSize := logits.Shape[2]
+	offset := (len(ids) - 1) * vocabSize
+	return tensor.NewFromData(logits.Data[offset:offset+vocabSize], vocabSize)
+}
+
 func (gpt *GPT) Backward(gradOutput *tensor.NDArray) {
 	// gradOutput: [B, T, Vocab]
 	
@@ -102,13 +199,25 @@ func (gpt *GPT) Backward(gradOutput *tensor.NDArray) {
 }
 
 func (gpt *GPT) Parameters() []*nn.Parameter {
-	var params []*nn.Parameter
-	params = append(params, gpt.WTE.Parameters()...)
-	params = append(params, gpt.WPE.Parameters()...)
-	for _, b := range gpt.Blocks {
-		params = append(params, b.Parameters()...)
+	named := gpt.NamedParameters()
+	params := make([]*nn.Parameter, len(named))
+	for i, np := range named {
+		params[i] = np.Param
+	}
+	return params
+}
+
+// NamedParameters returns every parameter with its fully qualified,
+// GPT-2 style name (wte.weight, blocks.0.attn.c_attn.weight, ...).
+// The order is stable and matches Parameters().
+func (gpt *GPT) NamedParameters() []nn.NamedParameter {
+	var params []nn.NamedParameter
+	params = append(params, gpt.WTE.NamedParameters("wte")...)
+	params = append(params, gpt.WPE.NamedParameters("wpe")...)
+	for i, b := range gpt.Blocks {
+		params = append(params, b.NamedParameters(fmt.Sprintf("blocks.%d", i))...)
 	}
-	params = append(params, gpt.LNF.Parameters()...)
-	params = append(params, gpt.LMHead.Parameters()...)
+	params = append(params, gpt.LNF.NamedParameters("ln_f")...)
+	params = append(params, gpt.LMHead.NamedParameters("lm_head")...)
 	return params
 }
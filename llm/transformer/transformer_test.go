@@ -127,3 +127,113 @@ func TestDeterministicTraining(t *testing.T) {
 		t.Errorf("Non-deterministic! %f != %f", val1, val2)
 	}
 }
+
+func TestForwardStepMatchesForward(t *testing.T) {
+	rand.Seed(7)
+	cfg := Config{
+		VocabSize: 30,
+		BlockSize: 10,
+		NLayer:    2,
+		NHead:     2,
+		NEmb:      8,
+		PDrop:     0.0,
+	}
+	gpt := NewGPT(cfg)
+
+	ids := make([]int, cfg.BlockSize)
+	x := tensor.New(1, len(ids))
+	for i := range ids {
+		ids[i] = rand.Intn(cfg.VocabSize)
+		x.Data[i] = float32(ids[i])
+	}
+	full := gpt.Forward(x) // [1, T, V]
+
+	// Prefill a prompt, then feed one token at a time.
+	cache := NewKVCache(cfg)
+	prompt := 4
+	var stepped []float32
+	stepped = append(stepped, gpt.ForwardStep(ids[:prompt], cache).Data...)
+	for i := prompt; i < len(ids); i++ {
+		stepped = append(stepped, gpt.ForwardStep(ids[i:i+1], cache).Data...)
+	}
+
+	if cache.Len() != len(ids) {
+		t.Fatalf("Expected cache length %d, got %d", len(ids), cache.Len())
+	}
+	for i, v := range full.Data {
+		if math.Abs(float64(v-stepped[i])) > 1e-5 {
+			t.Fatalf("Logit %d differs: full %f, cached %f", i, v, stepped[i])
+		}
+	}
+
+	// Truncate and replay the tail: must reproduce the same logits.
+	cache.Truncate(6)
+	replay := gpt.ForwardStep(ids[6:], cache)
+	vocab := cfg.VocabSize
+	for i, v := range replay.Data {
+		if math.Abs(float64(v-full.Data[6*vocab+i])) > 1e-5 {
+			t.Fatalf("Replayed logit %d differs: full %f, cached %f", i, full.Data[6*vocab+i], v)
+		}
+	}
+
+	// NextLogits rebuilds the cache from the last BlockSize tokens instead of
+	// overflowing: the logits match Forward on the cropped context.
+	next := gpt.NextLogits([]int{ids[0]}, cache)
+	if next.Size != vocab || cache.Len() != cfg.BlockSize {
+		t.Fatalf("Unexpected NextLogits result: size %d, cache length %d", next.Size, cache.Len())
+	}
+	cropped := tensor.New(1, cfg.BlockSize)
+	for i, id := range append(ids[1:], ids[0]) {
+		cropped.Data[i] = float32(id)
+	}
+	want := gpt.Forward(cropped).Data[(cfg.BlockSize-1)*vocab:]
+	for i, v := range next.Data {
+		if math.Abs(float64(v-want[i])) > 1e-5 {
+			t.Fatalf("NextLogits logit %d after overflow differs: cropped %f, cached %f", i, want[i], v)
+		}
+	}
+
+	// With Keep, the rebuild starts from fewer tokens.
+	cache.Keep = 3
+	gpt.NextLogits([]int{ids[1]}, cache)
+	if cache.Len() != 3 {
+		t.Errorf("Expected cache length 3 with Keep, got %d", cache.Len())
+	}
+}
+
+func TestEvalModeDisablesDropout(t *testing.T) {
+	rand.Seed(3)
+	cfg := Config{VocabSize: 20, BlockSize: 6, NLayer: 1, NHead: 2, NEmb: 8, PDrop: 0.5}
+	gpt := NewGPT(cfg)
+	r := rand.New(rand.NewSource(1))
+	gpt.SetRand(r)
+
+	x := tensor.New(2, cfg.BlockSize)
+	for i := range x.Data {
+		x.Data[i] = float32(i % cfg.VocabSize)
+	}
+	differ := func(a, b *tensor.NDArray) bool {
+		for i := range a.Data {
+			if a.Data[i] != b.Data[i] {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Evaluation is deterministic and leaves the random stream alone
+	gpt.SetTraining(false)
+	eval1 := gpt.Forward(x)
+	eval2 := gpt.Forward(x)
+	if differ(eval1, eval2) {
+		t.Error("evaluation forward passes differ")
+	}
+	if r.Int63() != rand.New(rand.NewSource(1)).Int63() {
+		t.Error("evaluation consumed random numbers")
+	}
+
+	gpt.SetTraining(true)
+	if !differ(eval1, gpt.Forward(x)) {
+		t.Error("dropout inactive after switching back to training")
+	}
+}
@@ -36,7 +36,7 @@ func TestEndToEndTraining(t *testing.T) {
 
 	// Tiny model config
 	cfg := transformer.Config{
-		VocabSize: tok.VocabSize,
+		VocabSize: tok.VocabSize(),
 		BlockSize: blockSize,
 		NLayer:    1,
 		NHead:     2,
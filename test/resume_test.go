@@ -0,0 +1,114 @@
+package test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/brucetruth/minigpt/llm/data"
+	llmio "github.com/brucetruth/minigpt/llm/io"
+	"github.com/brucetruth/minigpt/llm/nn"
+	"github.com/brucetruth/minigpt/llm/optim"
+	"github.com/brucetruth/minigpt/llm/tensor"
+	"github.com/brucetruth/minigpt/llm/transformer"
+)
+
+// run is a minimal training setup with a checkpointable RNG.
+type run struct {
+	model *transformer.GPT
+	opt   *optim.AdamW
+	sched *optim.CosineScheduleWithWarmup
+	ds    *data.TextDataset
+	src   *tensor.RNGSource
+}
+
+func newRun(cfg transformer.Config, tokens []int, seed int64) *run {
+	rand.Seed(seed)
+	src := tensor.NewRNGSource(seed)
+	rng := rand.New(src)
+
+	model := transformer.NewGPT(cfg)
+	model.SetRand(rng)
+	ds := data.NewTextDataset(tokens, cfg.BlockSize)
+	ds.Rand = rng
+
+	return &run{
+		model: model,
+		opt:   optim.NewAdamW(model.Parameters(), 0.01),
+		sched: optim.NewCosineScheduleWithWarmup(2, 8, 0.01, 0.001),
+		ds:    ds,
+		src:   src,
+	}
+}
+
+func (r *run) train(from, to int) {
+	criterion := nn.NewCrossEntropyLoss()
+	for step := from; step < to; step++ {
+		r.opt.SetLR(r.sched.GetLR(step))
+		x, y := r.ds.GetBatch(2)
+		logits := r.model.Forward(x)
+		b, timeSteps, v := logits.Shape[0], logits.Shape[1], logits.Shape[2]
+		logitsFlat, _ := logits.View(b*timeSteps, v)
+
+		r.opt.ZeroGrad()
+		dLogitsFlat := criterion.Backward(logitsFlat, y)
+		dLogits, _ := dLogitsFlat.View(b, timeSteps, v)
+		r.model.Backward(dLogits)
+		r.opt.ClipGradNorm(1.0)
+		r.opt.Step()
+	}
+}
+
+func TestResumeIsBitIdentical(t *testing.T) {
+	cfg := transformer.Config{
+		VocabSize: 16,
+		BlockSize: 6,
+		NLayer:    1,
+		NHead:     2,
+		NEmb:      8,
+		PDrop:     0.1, // Dropout must replay exactly too
+	}
+	tokens := make([]int, 200)
+	for i := range tokens {
+		tokens[i] = (i*7 + i/3) % cfg.VocabSize
+	}
+
+	// Uninterrupted
+	full := newRun(cfg, tokens, 1)
+	full.train(0, 8)
+
+	// Interrupted at step 4, checkpointed, then resumed in a fresh run
+	first := newRun(cfg, tokens, 1)
+	first.train(0, 4)
+	dir := t.TempDir()
+	if err := llmio.SaveCheckpoint(dir, first.model, llmio.CheckpointMetadata{Step: 4, Config: cfg}); err != nil {
+		t.Fatal(err)
+	}
+	state := &llmio.TrainingState{Step: 4, RNGState: first.src.State(), Optimizer: first.opt.State()}
+	if err := llmio.SaveTrainingState(dir, first.model, state); err != nil {
+		t.Fatal(err)
+	}
+
+	resumed := newRun(cfg, tokens, 99) // Different seed: everything must come from the checkpoint
+	if _, err := llmio.LoadCheckpoint(dir, resumed.model); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := llmio.LoadTrainingState(dir, resumed.model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := resumed.opt.LoadState(loaded.Optimizer); err != nil {
+		t.Fatal(err)
+	}
+	resumed.src.SetState(loaded.RNGState)
+	resumed.train(loaded.Step, 8)
+
+	want := full.model.NamedParameters()
+	got := resumed.model.Parameters()
+	for i, np := range want {
+		for j, v := range np.Param.Data.Data {
+			if got[i].Data.Data[j] != v {
+				t.Fatalf("%s[%d] diverged after resume: %v != %v", np.Name, j, got[i].Data.Data[j], v)
+			}
+		}
+	}
+}